@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -46,15 +47,112 @@ type RecipeSpec struct {
 	// +optional
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 
+	// Probes override the default probes of the recipe app, which call its
+	// /liveness and /readiness endpoints on port 5000
+	// +optional
+	Probes *ProbesSpec `json:"probes,omitempty"`
+
+	// Scheduling constraints of the recipe app pods. Unless an affinity is
+	// set, the replicas are preferably spread across nodes.
+	// +optional
+	Scheduling *SchedulingSpec `json:"scheduling,omitempty"`
+
+	// CommonLabels are set on every object created for the Recipe and on
+	// the pods, except where the operator sets the same key
+	// +optional
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+
+	// CommonAnnotations are set on every object created for the Recipe and
+	// on the pods, except where the operator sets the same key
+	// +optional
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
+
+	// PodAnnotations are set on the pods of the recipe app, of MySQL and of
+	// the Jobs, over commonAnnotations
+	// +optional
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+
 	// Hpa specifies the pod autoscaling configuration to use
 	// for the workload.
 	// +optional
 	Hpa *HpaSpec `json:"hpa,omitempty"`
 
+	// Service configures the Service of the recipe app
+	// +optional
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// Expose publishes the recipe app outside of the cluster with an
+	// OpenShift Route, a Gateway API HTTPRoute or an Ingress, depending on
+	// what the cluster supports
+	// +optional
+	Expose *ExposeSpec `json:"expose,omitempty"`
+
+	// NetworkPolicy restricts the traffic to MySQL and to the recipe app
+	// +optional
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
 	// Database specifies the database configuration to use
 	// for the workload.
 	// +optional
 	Database DatabaseSpec `json:"database,omitempty"`
+
+	// Source clones the database of another Recipe into this one when it is
+	// first provisioned, before the recipe app is deployed.
+	// +optional
+	Source *SourceSpec `json:"source,omitempty"`
+
+	// CloneAllowedNamespaces are the namespaces whose Recipes may clone this
+	// Recipe with spec.source.fromRecipe, "*" allows all namespaces. Recipes
+	// in the same namespace may always clone it.
+	// +optional
+	CloneAllowedNamespaces []string `json:"cloneAllowedNamespaces,omitempty"`
+}
+
+type ProbesSpec struct {
+	// Liveness probe of the recipe app container
+	// +optional
+	Liveness *corev1.Probe `json:"liveness,omitempty"`
+	// Readiness probe of the recipe app container
+	// +optional
+	Readiness *corev1.Probe `json:"readiness,omitempty"`
+	// Startup probe of the recipe app container
+	// +optional
+	Startup *corev1.Probe `json:"startup,omitempty"`
+}
+
+// SchedulingSpec holds the scheduling constraints set on the pods of a workload
+type SchedulingSpec struct {
+	// NodeSelector must match the labels of the node the pods are scheduled on
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations of the pods
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity of the pods
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints of the pods
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// PriorityClassName of the pods
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// RuntimeClassName of the pods
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+}
+
+type SourceSpec struct {
+	// FromRecipe is the Recipe whose database is cloned
+	FromRecipe RecipeReference `json:"fromRecipe"`
+}
+
+type RecipeReference struct {
+	// Name of the Recipe
+	Name string `json:"name"`
+	// Namespace of the Recipe, defaults to the namespace of this Recipe
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 type HpaSpec struct {
@@ -69,6 +167,102 @@ type HpaSpec struct {
 	TargetMemoryUtilization *int32 `json:"targetMemoryUtilization,omitempty"`
 }
 
+type ServiceSpec struct {
+	// Type of the Service, ClusterIP, NodePort or LoadBalancer. Defaults to ClusterIP.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Port the Service serves the recipe app on
+	// +kubebuilder:default:=80
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Annotations set on the Service, e.g. to configure the load balancer
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// SessionAffinity of the Service, None or ClientIP. Defaults to None.
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// +optional
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+	// LoadBalancerSourceRanges are the CIDRs allowed to reach a LoadBalancer Service
+	// +optional
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+}
+
+type ExposeSpec struct {
+	// Host is the hostname the recipe app is published on. When it is not
+	// set, an OpenShift Route gets a generated hostname and an Ingress or an
+	// HTTPRoute matches any hostname.
+	// +optional
+	Host string `json:"host,omitempty"`
+	// Path is the path prefix the recipe app is published on
+	// +kubebuilder:default:="/"
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+	// TLS terminates TLS for the host. An HTTPRoute relies on the listener
+	// of its Gateway to terminate TLS.
+	// +optional
+	TLS *ExposeTLSSpec `json:"tls,omitempty"`
+	// Annotations set on the Route, Ingress or HTTPRoute
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// IngressClassName of the Ingress
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+	// Gateway the HTTPRoute is attached to. An HTTPRoute is only created
+	// when a Gateway is set and the cluster serves the Gateway API.
+	// +optional
+	Gateway *GatewayReference `json:"gateway,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="!has(self.validity) || !has(self.renewBefore) || duration(self.renewBefore) < duration(self.validity)",message="renewBefore must be shorter than validity"
+type ExposeTLSSpec struct {
+	// SecretName is the kubernetes.io/tls Secret holding the certificate
+	// and the key of the host. With generate, it defaults to <name>-tls.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// Generate makes the operator issue a serving certificate for the host,
+	// signed by a self-signed CA kept in the <name>-ca Secret, and renew it
+	// before it expires
+	// +optional
+	Generate bool `json:"generate,omitempty"`
+	// Validity of the generated serving certificate
+	// +kubebuilder:default:="2160h"
+	// +optional
+	Validity *metav1.Duration `json:"validity,omitempty"`
+	// RenewBefore is how long before its expiry the generated certificate is
+	// renewed. It must be shorter than validity.
+	// +kubebuilder:default:="720h"
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+type GatewayReference struct {
+	// Name of the Gateway
+	Name string `json:"name"`
+	// Namespace of the Gateway, defaults to the namespace of this Recipe
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// SectionName is the listener of the Gateway the HTTPRoute is attached to
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+type NetworkPolicySpec struct {
+	// Enabled creates NetworkPolicies only allowing the recipe app and the
+	// Jobs of the operator to reach MySQL, and the peers of appIngressFrom to
+	// reach the recipe app
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// AppIngressFrom are the namespaces and pods allowed to reach the recipe
+	// app, e.g. those of the ingress controller. Only the pods of the
+	// namespace of the Recipe may reach it when it is empty.
+	// +optional
+	AppIngressFrom []networkingv1.NetworkPolicyPeer `json:"appIngressFrom,omitempty"`
+}
+
 type DatabaseSpec struct {
 	// Image set the image which should be used at MySQL DB.
 	// +optional
@@ -79,15 +273,155 @@ type DatabaseSpec struct {
 	// SecurityContext in case of Openshift
 	// +optional
 	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// Resources of the MySQL container
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// JobResources are the resources of the containers of the backup, restore,
+	// verification and other Jobs run against the database
+	// +optional
+	JobResources corev1.ResourceRequirements `json:"jobResources,omitempty"`
+	// Scheduling constraints of the MySQL pod
+	// +optional
+	Scheduling *SchedulingSpec `json:"scheduling,omitempty"`
+	// JobScheduling are the scheduling constraints of the backup, restore,
+	// verification and other Jobs run against the database
+	// +optional
+	JobScheduling *SchedulingSpec `json:"jobScheduling,omitempty"`
 	// BackupPolicy
 	// +optional
 	BackupPolicy BackupPolicySpec `json:"backupPolicySpec,omitempty"`
 	// InitRestore
 	// +optional
 	InitRestore bool `json:"initRestore,omitempty"`
+	// InitFrom loads a dump into the database once, when the Recipe is first
+	// provisioned, before the recipe app is deployed.
+	// +optional
+	InitFrom *InitFromSpec `json:"initFrom,omitempty"`
+	// Name of the database of the recipe app. It cannot be changed once the
+	// database is initialized.
+	// +kubebuilder:default=recipes
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_]+$`
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="name is immutable"
+	// +optional
+	Name string `json:"name,omitempty"`
+	// User of the recipe app in the database. It cannot be changed once the
+	// database is initialized.
+	// +kubebuilder:default=recipeuser
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_]+$`
+	// +kubebuilder:validation:MaxLength=32
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="user is immutable"
+	// +optional
+	User string `json:"user,omitempty"`
+	// Config holds MySQL server options, rendered in the [mysqld] section of a
+	// my.cnf mounted into the MySQL pod, e.g. max_connections: "200".
+	// MySQL is restarted when they change.
+	// +optional
+	Config map[string]string `json:"config,omitempty"`
+	// InitScripts run when the database is first initialized, after the
+	// generated script creating the recipe user, in the order they are listed.
+	// +optional
+	InitScripts []InitScriptSource `json:"initScripts,omitempty"`
+	// TLS encrypts the connections of the recipe app and of the Jobs to MySQL
+	// +optional
+	TLS *DatabaseTLSSpec `json:"tls,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="!has(self.validity) || !has(self.renewBefore) || duration(self.renewBefore) < duration(self.validity)",message="renewBefore must be shorter than validity"
+type DatabaseTLSSpec struct {
+	// Enabled issues a server certificate for MySQL, signed by the CA of the
+	// <name>-ca Secret, makes the recipe app and the Jobs connect with TLS and
+	// sets require_secure_transport so that MySQL rejects plain connections.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// AllowInsecureTransport keeps MySQL accepting plain connections, for the
+	// images of the recipe app which do not connect with TLS yet.
+	// +optional
+	AllowInsecureTransport bool `json:"allowInsecureTransport,omitempty"`
+	// Validity of the MySQL server certificate
+	// +kubebuilder:default:="8760h"
+	// +optional
+	Validity *metav1.Duration `json:"validity,omitempty"`
+	// RenewBefore is how long before its expiry the MySQL server certificate
+	// is renewed, which restarts MySQL. It must be shorter than validity.
+	// +kubebuilder:default:="720h"
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+// InitScriptSource references the SQL files of a ConfigMap or a Secret.
+// Exactly one of ConfigMap and Secret must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.configMap) != has(self.secret)",message="exactly one of configMap and secret must be set"
+type InitScriptSource struct {
+	// ConfigMap in the namespace of the Recipe holding the scripts
+	// +optional
+	ConfigMap *corev1.LocalObjectReference `json:"configMap,omitempty"`
+	// Secret in the namespace of the Recipe holding the scripts, e.g. to create extra users
+	// +optional
+	Secret *corev1.LocalObjectReference `json:"secret,omitempty"`
+	// Keys of the scripts to run, in order. MySQL runs .sql, .sql.gz and .sh files.
+	// +kubebuilder:validation:MinItems=1
+	Keys []string `json:"keys"`
+}
+
+// InitFromSpec is the source of the dump loaded into a new database.
+// Exactly one source must be set. Dumps ending with .gz are decompressed
+// and dumps ending with .enc are decrypted.
+// +kubebuilder:validation:XValidation:rule="[has(self.persistentVolumeClaim), has(self.configMap), has(self.s3)].filter(s, s).size() == 1",message="exactly one of persistentVolumeClaim, configMap and s3 must be set"
+type InitFromSpec struct {
+	// PersistentVolumeClaim holding the dump, e.g. the backup volume of another Recipe
+	// +optional
+	PersistentVolumeClaim *InitFromPersistentVolumeClaimSource `json:"persistentVolumeClaim,omitempty"`
+	// ConfigMap holding the dump in one of its keys
+	// +optional
+	ConfigMap *InitFromConfigMapSource `json:"configMap,omitempty"`
+	// S3 object holding the dump
+	// +optional
+	S3 *InitFromS3Source `json:"s3,omitempty"`
+	// Encryption the dump was encrypted with, e.g. the one of the backups of
+	// the other Recipe. Required for dumps ending with .enc.
+	// +optional
+	Encryption *BackupEncryptionSpec `json:"encryption,omitempty"`
+}
+
+type InitFromPersistentVolumeClaimSource struct {
+	// ClaimName of the PVC in the namespace of the Recipe
+	ClaimName string `json:"claimName"`
+	// Path of the dump in the volume, e.g. daily/202406150000.recipes.sql.gz
+	Path string `json:"path"`
+}
+
+type InitFromConfigMapSource struct {
+	// Name of the ConfigMap in the namespace of the Recipe
+	Name string `json:"name"`
+	// Key of the dump in the data or binaryData of the ConfigMap
+	Key string `json:"key"`
+}
+
+type InitFromS3Source struct {
+	S3DestinationSpec `json:",inline"`
+	// Key of the dump object, relative to the prefix
+	Key string `json:"key"`
 }
 
+const (
+	// BackupMethodDump backs the database up with mysqldump
+	BackupMethodDump = "dump"
+	// BackupMethodSnapshot backs the database up with CSI VolumeSnapshots of the MySQL volume
+	BackupMethodSnapshot = "snapshot"
+)
+
 type BackupPolicySpec struct {
+	// Method of the backups: dump runs mysqldump, snapshot takes a CSI
+	// VolumeSnapshot of the MySQL volume while the tables are locked.
+	// Defaults to dump.
+	// +kubebuilder:validation:Enum=dump;snapshot
+	// +optional
+	Method string `json:"method,omitempty"`
+	// VolumeSnapshotClassName is the class of the snapshots taken with the
+	// snapshot method. The default class of the CSI driver is used when empty.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
 	// Backup Schedule
 	// +optional
 	Schedule string `json:"schedule,omitempty"`
@@ -97,6 +431,95 @@ type BackupPolicySpec struct {
 	// VolumeName which should be used at MySQL DB.
 	// +optional
 	VolumeName string `json:"volumeName,omitempty"`
+	// Retention is the number of backups kept for Schedule. Defaults to 2.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Retention *int32 `json:"retention,omitempty"`
+	// Schedules are additional named backup schedules, e.g. hourly, daily and weekly.
+	// Each one runs its own CronJob and only prunes its own backups. The
+	// CronJob is named <name>-backup-<schedule>, so the names of the Recipe
+	// and of the schedule are limited to 44 characters together.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Schedules []BackupScheduleSpec `json:"schedules,omitempty"`
+	// Destination of the backups. Backups are stored on the backup volume when unset.
+	// +optional
+	Destination BackupDestinationSpec `json:"destination,omitempty"`
+	// Verification periodically restores the latest backup into a throwaway
+	// database and checks the recipes table.
+	// +optional
+	Verification *BackupVerificationSpec `json:"verification,omitempty"`
+	// Compression of the backups, gzip or none. Defaults to gzip.
+	// +kubebuilder:validation:Enum=gzip;none
+	// +optional
+	Compression string `json:"compression,omitempty"`
+	// Encryption of the backups. Backups are stored in clear text when unset.
+	// +optional
+	Encryption *BackupEncryptionSpec `json:"encryption,omitempty"`
+	// PointInTimeRecovery enables binary logging on the MySQL instance and
+	// archives the binary logs next to the backups, so that a RecipeRestore
+	// can replay them up to a target time.
+	// +optional
+	PointInTimeRecovery *PointInTimeRecoverySpec `json:"pointInTimeRecovery,omitempty"`
+	// UnhealthyAfterIntervals is the number of schedule intervals without a
+	// successful backup after which the BackupHealthy condition turns false.
+	// Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	UnhealthyAfterIntervals *int32 `json:"unhealthyAfterIntervals,omitempty"`
+}
+
+type BackupEncryptionSpec struct {
+	// KeySecretRef selects the Secret key holding the passphrase the backups
+	// are encrypted with, using openssl AES-256-CBC.
+	KeySecretRef corev1.SecretKeySelector `json:"keySecretRef"`
+}
+
+type PointInTimeRecoverySpec struct {
+	// ArchiveSchedule in Cron format on which the binary logs are archived.
+	// Changes made after the last archive cannot be recovered. Defaults to every 5 minutes.
+	// +optional
+	ArchiveSchedule string `json:"archiveSchedule,omitempty"`
+}
+
+type BackupVerificationSpec struct {
+	// Schedule in Cron format on which the latest backup is verified
+	Schedule string `json:"schedule"`
+}
+
+type BackupDestinationSpec struct {
+	// S3 stores the backups in an S3-compatible object storage instead of the backup volume
+	// +optional
+	S3 *S3DestinationSpec `json:"s3,omitempty"`
+}
+
+type S3DestinationSpec struct {
+	// Endpoint is the URL of the S3-compatible service, e.g. https://s3.amazonaws.com
+	Endpoint string `json:"endpoint"`
+	// Bucket the backups are stored in
+	Bucket string `json:"bucket"`
+	// Prefix of the backup objects in the bucket
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecretRef references a Secret with the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY keys
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+type BackupScheduleSpec struct {
+	// Name of the schedule. Its backups are stored in a directory of the same
+	// name on the backup volume. pre-upgrade is reserved for the backups taken
+	// before the MySQL image is changed.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=32
+	// +kubebuilder:validation:XValidation:rule="self != 'pre-upgrade'",message="pre-upgrade is reserved for the pre-upgrade backups"
+	Name string `json:"name"`
+	// Schedule in Cron format
+	Schedule string `json:"schedule"`
+	// Retention is the number of backups kept for this schedule
+	// +kubebuilder:validation:Minimum=1
+	Retention int32 `json:"retention"`
 }
 
 // RecipeStatus defines the observed state of Recipe
@@ -104,10 +527,166 @@ type RecipeStatus struct {
 	MySQLStatus     string `json:"mysqlStatus,omitempty"`
 	RecipeAppStatus string `json:"recipeAppStatus,omitempty"`
 	RecipeAppHpa    string `json:"recipeAppHpa,omitempty"`
+	// URL the recipe app is published on with spec.expose
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Certificate reports the serving certificate generated with spec.expose.tls.generate
+	// +optional
+	Certificate *CertificateStatus `json:"certificate,omitempty"`
+	// DatabaseCertificate reports the MySQL server certificate generated with spec.database.tls
+	// +optional
+	DatabaseCertificate *CertificateStatus `json:"databaseCertificate,omitempty"`
+	// DatabaseVolumeClaim is the PVC holding the MySQL data when it was
+	// restored from a snapshot, instead of <name>-mysql
+	// +optional
+	DatabaseVolumeClaim string `json:"databaseVolumeClaim,omitempty"`
+	// BackupVerification is the outcome of the latest backup verification
+	// +optional
+	BackupVerification *BackupVerificationStatus `json:"backupVerification,omitempty"`
+	// Backup reports the health and history of the scheduled backups
+	// +optional
+	Backup *BackupStatus `json:"backup,omitempty"`
+	// Clone reports the progress of cloning spec.source.fromRecipe
+	// +optional
+	Clone *CloneStatus `json:"clone,omitempty"`
+	// DatabaseUpgrade reports the progress of the latest change of spec.database.image
+	// +optional
+	DatabaseUpgrade *DatabaseUpgradeStatus `json:"databaseUpgrade,omitempty"`
+	// Conditions represent the latest available observations of the Recipe state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ClonePhase describes the progress of cloning a Recipe
+type ClonePhase string
+
+const (
+	// ClonePhasePending means the source Recipe cannot be cloned yet
+	ClonePhasePending ClonePhase = "Pending"
+	// ClonePhaseCloning means the clone Job is copying the source database
+	ClonePhaseCloning ClonePhase = "Cloning"
+	// ClonePhaseCompleted means the source database was copied
+	ClonePhaseCompleted ClonePhase = "Completed"
+	// ClonePhaseFailed means the clone Job failed
+	ClonePhaseFailed ClonePhase = "Failed"
+)
+
+type CloneStatus struct {
+	// Source is the cloned Recipe, as namespace/name
+	Source string `json:"source"`
+	// Phase is the current phase of the clone
+	// +optional
+	Phase ClonePhase `json:"phase,omitempty"`
+	// StartTime is when the clone Job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the clone completed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message gives details about the progress of the clone
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DatabaseUpgradePhase describes the progress of a change of the MySQL image
+type DatabaseUpgradePhase string
+
+const (
+	// DatabaseUpgradePhaseBackingUp means the pre-upgrade backup Job is running
+	DatabaseUpgradePhaseBackingUp DatabaseUpgradePhase = "BackingUp"
+	// DatabaseUpgradePhaseScalingDown means the recipe app is being scaled to zero
+	DatabaseUpgradePhaseScalingDown DatabaseUpgradePhase = "ScalingDown"
+	// DatabaseUpgradePhaseUpgrading means MySQL is restarting with the new image
+	DatabaseUpgradePhaseUpgrading DatabaseUpgradePhase = "Upgrading"
+	// DatabaseUpgradePhaseVerifying means the upgrade Job runs mysql_upgrade and checks the tables
+	DatabaseUpgradePhaseVerifying DatabaseUpgradePhase = "Verifying"
+	// DatabaseUpgradePhaseRollingBack means MySQL is restarting with the previous image on an empty volume
+	DatabaseUpgradePhaseRollingBack DatabaseUpgradePhase = "RollingBack"
+	// DatabaseUpgradePhaseRestoring means the pre-upgrade backup is being restored
+	DatabaseUpgradePhaseRestoring DatabaseUpgradePhase = "Restoring"
+	// DatabaseUpgradePhaseCompleted means MySQL runs the new image
+	DatabaseUpgradePhaseCompleted DatabaseUpgradePhase = "Completed"
+	// DatabaseUpgradePhaseFailed means the pre-upgrade backup failed and MySQL was left untouched
+	DatabaseUpgradePhaseFailed DatabaseUpgradePhase = "Failed"
+	// DatabaseUpgradePhaseRolledBack means the upgrade failed, MySQL runs the
+	// previous image with the pre-upgrade backup
+	DatabaseUpgradePhaseRolledBack DatabaseUpgradePhase = "RolledBack"
+	// DatabaseUpgradePhaseRollbackFailed means the pre-upgrade backup could not
+	// be restored, the recipe app is kept scaled down
+	DatabaseUpgradePhaseRollbackFailed DatabaseUpgradePhase = "RollbackFailed"
+)
+
+type DatabaseUpgradeStatus struct {
+	// FromImage is the MySQL image before the upgrade
+	FromImage string `json:"fromImage"`
+	// ToImage is the MySQL image requested by spec.database.image
+	ToImage string `json:"toImage"`
+	// Phase is the current phase of the upgrade
+	// +optional
+	Phase DatabaseUpgradePhase `json:"phase,omitempty"`
+	// Backup is the pre-upgrade backup, relative to the backup volume or S3 prefix
+	// +optional
+	Backup string `json:"backup,omitempty"`
+	// StartTime is when the upgrade started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the upgrade completed, failed or was rolled back
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message gives details about the progress of the upgrade
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+type BackupStatus struct {
+	// LastScheduleTime is when a backup Job was last scheduled
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is when the last successful backup Job finished
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// LastFailedTime is when the last failed backup Job finished
+	// +optional
+	LastFailedTime *metav1.Time `json:"lastFailedTime,omitempty"`
+	// ConsecutiveFailures is the number of backup Jobs which failed since the last successful one
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+	// LatestBackup is the name of the backup written by the last successful backup Job
+	// +optional
+	LatestBackup string `json:"latestBackup,omitempty"`
+}
+
+type CertificateStatus struct {
+	// SecretName is the Secret holding the generated certificate
+	SecretName string `json:"secretName"`
+	// NotAfter is when the certificate expires
+	// +optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// RenewalTime is when the certificate is renewed
+	// +optional
+	RenewalTime *metav1.Time `json:"renewalTime,omitempty"`
+	// CANotAfter is when the CA signing the certificate expires
+	// +optional
+	CANotAfter *metav1.Time `json:"caNotAfter,omitempty"`
+}
+
+type BackupVerificationStatus struct {
+	// LastVerificationTime is when the latest verification finished
+	// +optional
+	LastVerificationTime *metav1.Time `json:"lastVerificationTime,omitempty"`
+	// Result of the latest verification, Succeeded or Failed
+	// +optional
+	Result string `json:"result,omitempty"`
+	// Message reported by the latest verification
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:validation:XValidation:rule="!has(self.spec) || !has(self.spec.database) || !has(self.spec.database.backupPolicySpec) || !has(self.spec.database.backupPolicySpec.schedules) || self.spec.database.backupPolicySpec.schedules.all(s, size(self.metadata.name) + size(s.name) <= 44)",message="the name of the Recipe and the name of a backup schedule are limited to 44 characters together, for the <name>-backup-<schedule> CronJob"
 
 // Recipe is the Schema for the recipes API
 type Recipe struct {
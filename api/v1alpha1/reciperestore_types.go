@@ -0,0 +1,105 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RecipeRestoreSpec defines the desired state of RecipeRestore
+type RecipeRestoreSpec struct {
+	// RecipeName is the name of the Recipe, in the same namespace,
+	// whose database should be restored.
+	RecipeName string `json:"recipeName"`
+
+	// BackupName is the backup file on the Recipe backup volume to restore,
+	// e.g. 202406150131.recipes.sql.gz, or daily/202406150000.recipes.sql.gz
+	// for a named schedule. The latest backup is restored when empty.
+	// +kubebuilder:validation:Pattern=`^([a-z0-9-]+/)?[0-9]+\.[A-Za-z0-9_]+\.sql(\.gz)?(\.enc)?$`
+	// +optional
+	BackupName string `json:"backupName,omitempty"`
+
+	// TargetTime replays the archived binary logs on top of the backup up to
+	// this time. The Recipe must have pointInTimeRecovery enabled. When
+	// BackupName is empty, the latest backup taken before TargetTime is used.
+	// +optional
+	TargetTime *metav1.Time `json:"targetTime,omitempty"`
+
+	// SnapshotName is a VolumeSnapshot of the Recipe MySQL volume to restore.
+	// MySQL is restarted on a new PVC created from the snapshot, BackupName
+	// and TargetTime are ignored.
+	// +optional
+	SnapshotName string `json:"snapshotName,omitempty"`
+}
+
+// RestorePhase describes the progress of a RecipeRestore
+type RestorePhase string
+
+const (
+	// RestorePhaseScalingDown means the recipe app is being scaled to zero
+	RestorePhaseScalingDown RestorePhase = "ScalingDown"
+	// RestorePhaseRestoring means the restore Job is running
+	RestorePhaseRestoring RestorePhase = "Restoring"
+	// RestorePhaseCompleted means the backup was restored and the app scaled back
+	RestorePhaseCompleted RestorePhase = "Completed"
+	// RestorePhaseFailed means the restore could not be performed
+	RestorePhaseFailed RestorePhase = "Failed"
+)
+
+// RecipeRestoreStatus defines the observed state of RecipeRestore
+type RecipeRestoreStatus struct {
+	// Phase is the current phase of the restore
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+	// StartTime is when the restore started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the restore reached Completed or Failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message gives details about the outcome of the restore
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Recipe",type=string,JSONPath=`.spec.recipeName`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// RecipeRestore is the Schema for the reciperestores API
+type RecipeRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RecipeRestoreSpec   `json:"spec,omitempty"`
+	Status RecipeRestoreStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RecipeRestoreList contains a list of RecipeRestore
+type RecipeRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RecipeRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RecipeRestore{}, &RecipeRestoreList{})
+}
@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+const (
+	// typeBackupHealthyRecipe represents whether the scheduled backups of the Recipe succeed
+	typeBackupHealthyRecipe = "BackupHealthy"
+
+	// defaultUnhealthyAfterIntervals is the number of schedule intervals without
+	// a successful backup after which the backups are considered unhealthy
+	defaultUnhealthyAfterIntervals = 3
+)
+
+// finishedJob is a Job which completed or failed
+type finishedJob struct {
+	job        *batchv1.Job
+	finishedAt metav1.Time
+	succeeded  bool
+}
+
+// updateBackupStatus records the history and health of the scheduled backups
+// and the outcome of the latest backup verification on the recipe status.
+// It returns when the backup health should be checked again.
+func (r *RecipeReconciler) updateBackupStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (time.Duration, error) {
+	original := recipe.Status.DeepCopy()
+
+	requeueAfter, err := r.setBackupStatus(ctx, recipe)
+	if err != nil {
+		return 0, err
+	}
+	err = r.setBackupVerificationStatus(ctx, recipe)
+	if err != nil {
+		return 0, err
+	}
+
+	if equality.Semantic.DeepEqual(original, &recipe.Status) {
+		return requeueAfter, nil
+	}
+	return requeueAfter, r.Status().Update(ctx, recipe)
+}
+
+// setBackupStatus derives status.backup and the BackupHealthy condition
+// from the Jobs of the backup CronJobs, or from the VolumeSnapshots.
+func (r *RecipeReconciler) setBackupStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (time.Duration, error) {
+	schedules := resources.BackupSchedulesForRecipe(recipe)
+	if len(schedules) == 0 {
+		recipe.Status.Backup = nil
+		meta.RemoveStatusCondition(&recipe.Status.Conditions, typeBackupHealthyRecipe)
+		return 0, nil
+	}
+
+	status := &devconfczv1alpha1.BackupStatus{}
+	if recipe.Status.Backup != nil {
+		status = recipe.Status.Backup.DeepCopy()
+	}
+
+	var expectedSince metav1.Time
+	var err error
+	if recipe.Spec.Database.BackupPolicy.Method == devconfczv1alpha1.BackupMethodSnapshot {
+		expectedSince, err = r.snapshotBackupStatus(ctx, recipe, status)
+	} else {
+		expectedSince, err = r.jobBackupStatus(ctx, recipe, status)
+	}
+	if err != nil {
+		return 0, err
+	}
+	recipe.Status.Backup = status
+
+	// Backups are unhealthy when none succeeded for several schedule intervals
+	interval := shortestScheduleInterval(schedules)
+	if interval == 0 {
+		meta.RemoveStatusCondition(&recipe.Status.Conditions, typeBackupHealthyRecipe)
+		return 0, nil
+	}
+	intervals := int32(defaultUnhealthyAfterIntervals)
+	if recipe.Spec.Database.BackupPolicy.UnhealthyAfterIntervals != nil {
+		intervals = *recipe.Spec.Database.BackupPolicy.UnhealthyAfterIntervals
+	}
+	threshold := time.Duration(intervals) * interval
+
+	since := expectedSince
+	if status.LastSuccessfulTime != nil {
+		since = *status.LastSuccessfulTime
+	}
+	elapsed := time.Since(since.Time)
+
+	condition := metav1.Condition{
+		Type:               typeBackupHealthyRecipe,
+		ObservedGeneration: recipe.Generation,
+	}
+	switch {
+	case elapsed > threshold:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "BackupOverdue"
+		condition.Message = fmt.Sprintf("No successful backup for more than %d schedule intervals", intervals)
+	case status.LastSuccessfulTime == nil:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "AwaitingBackup"
+		condition.Message = "No backup has completed yet"
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "BackupSucceeded"
+		condition.Message = fmt.Sprintf("Latest backup %s succeeded", status.LatestBackup)
+	}
+	meta.SetStatusCondition(&recipe.Status.Conditions, condition)
+
+	if elapsed > threshold {
+		return interval, nil
+	}
+	return threshold - elapsed, nil
+}
+
+// jobBackupStatus accounts the backup Jobs which finished since the last
+// reconcile in the backup status, and returns since when backups are expected.
+// The backup taken before a MySQL upgrade is not one of the scheduled backups.
+func (r *RecipeReconciler) jobBackupStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.BackupStatus) (metav1.Time, error) {
+	scheduled, err := labels.NewRequirement(resources.BackupScheduleLabel, selection.Exists, nil)
+	if err != nil {
+		return metav1.Time{}, err
+	}
+	notPreUpgrade, err := labels.NewRequirement(resources.BackupScheduleLabel, selection.NotIn, []string{resources.PreUpgradeBackupGeneration})
+	if err != nil {
+		return metav1.Time{}, err
+	}
+	selector := []client.ListOption{
+		client.InNamespace(recipe.Namespace),
+		client.MatchingLabelsSelector{
+			Selector: labels.SelectorFromSet(labels.Set{"app": recipe.Name}).Add(*scheduled, *notPreUpgrade),
+		},
+	}
+	cronJobs := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobs, selector...); err != nil {
+		return metav1.Time{}, err
+	}
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, selector...); err != nil {
+		return metav1.Time{}, err
+	}
+
+	// Backups are expected from the time the oldest backup CronJob was created
+	expectedSince := metav1.Now()
+	for _, cronJob := range cronJobs.Items {
+		if cronJob.CreationTimestamp.Before(&expectedSince) {
+			expectedSince = cronJob.CreationTimestamp
+		}
+		last := cronJob.Status.LastScheduleTime
+		if last != nil && (status.LastScheduleTime == nil || status.LastScheduleTime.Before(last)) {
+			status.LastScheduleTime = last
+		}
+	}
+
+	// Account for the Jobs which finished since the last reconcile, oldest first
+	var seenUntil metav1.Time
+	if status.LastSuccessfulTime != nil {
+		seenUntil = *status.LastSuccessfulTime
+	}
+	if status.LastFailedTime != nil && seenUntil.Before(status.LastFailedTime) {
+		seenUntil = *status.LastFailedTime
+	}
+	finished := finishedJobs(jobs.Items)
+	for i := len(finished) - 1; i >= 0; i-- {
+		job := finished[i]
+		if !seenUntil.Before(&job.finishedAt) {
+			continue
+		}
+		if job.succeeded {
+			latestBackup, err := r.jobTerminationMessage(ctx, job.job)
+			if err != nil {
+				return metav1.Time{}, err
+			}
+			status.LastSuccessfulTime = &job.finishedAt
+			status.LatestBackup = latestBackup
+			status.ConsecutiveFailures = 0
+		} else {
+			status.LastFailedTime = &job.finishedAt
+			status.ConsecutiveFailures++
+		}
+	}
+	return expectedSince, nil
+}
+
+// setBackupVerificationStatus records the outcome of the most recently
+// finished backup verification Job.
+func (r *RecipeReconciler) setBackupVerificationStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe) error {
+	jobs := &batchv1.JobList{}
+	err := r.List(ctx, jobs, client.InNamespace(recipe.Namespace),
+		client.MatchingLabels{"app": recipe.Name, resources.BackupVerificationLabel: "true"})
+	if err != nil {
+		return err
+	}
+
+	finished := finishedJobs(jobs.Items)
+	if len(finished) == 0 {
+		return nil
+	}
+	latest := finished[0]
+
+	status := &devconfczv1alpha1.BackupVerificationStatus{
+		LastVerificationTime: &latest.finishedAt,
+		Result:               "Failed",
+	}
+	if latest.succeeded {
+		status.Result = "Succeeded"
+	}
+	status.Message, err = r.jobTerminationMessage(ctx, latest.job)
+	if err != nil {
+		return err
+	}
+	recipe.Status.BackupVerification = status
+	return nil
+}
+
+// finishedJobs returns the Jobs which completed or failed, most recent first
+func finishedJobs(jobs []batchv1.Job) []finishedJob {
+	finished := []finishedJob{}
+	for i := range jobs {
+		for _, c := range jobs[i].Status.Conditions {
+			if c.Status != corev1.ConditionTrue || (c.Type != batchv1.JobComplete && c.Type != batchv1.JobFailed) {
+				continue
+			}
+			finished = append(finished, finishedJob{
+				job:        &jobs[i],
+				finishedAt: c.LastTransitionTime,
+				succeeded:  c.Type == batchv1.JobComplete,
+			})
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[j].finishedAt.Before(&finished[i].finishedAt)
+	})
+	return finished
+}
+
+// shortestScheduleInterval returns the time between two runs of the most
+// frequent backup schedule, or zero when no schedule can be parsed.
+func shortestScheduleInterval(schedules []devconfczv1alpha1.BackupScheduleSpec) time.Duration {
+	var shortest time.Duration
+	now := time.Now()
+	for _, schedule := range schedules {
+		sched, err := cron.ParseStandard(schedule.Schedule)
+		if err != nil {
+			continue
+		}
+		next := sched.Next(now)
+		interval := sched.Next(next).Sub(next)
+		if shortest == 0 || interval < shortest {
+			shortest = interval
+		}
+	}
+	return shortest
+}
+
+// jobTerminationMessage returns the termination message of the last container
+// which terminated in the pods of the Job.
+func (r *RecipeReconciler) jobTerminationMessage(ctx context.Context, job *batchv1.Job) (string, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return "", err
+	}
+	message := ""
+	var finishedAt metav1.Time
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Terminated == nil || cs.State.Terminated.Message == "" {
+				continue
+			}
+			if message == "" || finishedAt.Before(&cs.State.Terminated.FinishedAt) {
+				message = strings.TrimSpace(cs.State.Terminated.Message)
+				finishedAt = cs.State.Terminated.FinishedAt
+			}
+		}
+	}
+	return message, nil
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// backupTestCronJob returns the backup CronJob of the hourly schedule created the given time ago
+func backupTestCronJob(age time.Duration) *batchv1.CronJob {
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "recipe-backup-hourly",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			Labels:            map[string]string{"app": "recipe", resources.BackupScheduleLabel: "hourly"},
+		},
+	}
+}
+
+// backupTestJob returns a backup Job which finished the given time ago
+func backupTestJob(name string, condition batchv1.JobConditionType, age time.Duration) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"app": "recipe", resources.BackupScheduleLabel: "hourly"},
+		},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{
+				Type:               condition,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-age)),
+			}},
+		},
+	}
+}
+
+// backupTestPreUpgradeJob returns the backup Job taken before a MySQL upgrade
+func backupTestPreUpgradeJob(condition batchv1.JobConditionType, age time.Duration) *batchv1.Job {
+	job := backupTestJob("recipe-pre-upgrade-backup", condition, age)
+	job.Labels[resources.BackupScheduleLabel] = resources.PreUpgradeBackupGeneration
+	return job
+}
+
+// backupTestPod returns the pod of a backup Job reporting the written backup
+func backupTestPod(job, backup string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job + "-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{"job-name": job},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Message: backup + "\n"},
+				},
+			}},
+		},
+	}
+}
+
+func TestSetBackupStatus(t *testing.T) {
+	lastFailed := metav1.NewTime(time.Now().Add(-90 * time.Minute))
+
+	tests := []struct {
+		name                    string
+		schedules               []devconfczv1alpha1.BackupScheduleSpec
+		unhealthyAfterIntervals *int32
+		status                  *devconfczv1alpha1.BackupStatus
+		objects                 []client.Object
+
+		// wantStatus is empty when the condition is removed
+		wantStatus              metav1.ConditionStatus
+		wantReason              string
+		wantConsecutiveFailures int32
+		wantLatestBackup        string
+	}{
+		{
+			name:   "no schedule",
+			status: &devconfczv1alpha1.BackupStatus{LatestBackup: "hourly/202406150000.recipes.sql.gz"},
+		},
+		{
+			name:       "no backup yet",
+			objects:    []client.Object{backupTestCronJob(time.Hour)},
+			wantStatus: metav1.ConditionUnknown,
+			wantReason: "AwaitingBackup",
+		},
+		{
+			name:       "no backup for several intervals",
+			objects:    []client.Object{backupTestCronJob(5 * time.Hour)},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "BackupOverdue",
+		},
+		{
+			name:                    "no backup within the configured intervals",
+			unhealthyAfterIntervals: &[]int32{10}[0],
+			objects:                 []client.Object{backupTestCronJob(5 * time.Hour)},
+			wantStatus:              metav1.ConditionUnknown,
+			wantReason:              "AwaitingBackup",
+		},
+		{
+			name: "recent backup",
+			objects: []client.Object{
+				backupTestCronJob(5 * time.Hour),
+				backupTestJob("recipe-backup-hourly-1", batchv1.JobComplete, 30*time.Minute),
+				backupTestPod("recipe-backup-hourly-1", "hourly/202406150000.recipes.sql.gz"),
+			},
+			wantStatus:       metav1.ConditionTrue,
+			wantReason:       "BackupSucceeded",
+			wantLatestBackup: "hourly/202406150000.recipes.sql.gz",
+		},
+		{
+			name: "failures after a recent backup",
+			objects: []client.Object{
+				backupTestCronJob(5 * time.Hour),
+				backupTestJob("recipe-backup-hourly-1", batchv1.JobComplete, 150*time.Minute),
+				backupTestPod("recipe-backup-hourly-1", "hourly/202406150000.recipes.sql.gz"),
+				backupTestJob("recipe-backup-hourly-2", batchv1.JobFailed, 90*time.Minute),
+				backupTestJob("recipe-backup-hourly-3", batchv1.JobFailed, 30*time.Minute),
+			},
+			wantStatus:              metav1.ConditionTrue,
+			wantReason:              "BackupSucceeded",
+			wantConsecutiveFailures: 2,
+			wantLatestBackup:        "hourly/202406150000.recipes.sql.gz",
+		},
+		{
+			name: "failures for several intervals",
+			objects: []client.Object{
+				backupTestCronJob(10 * time.Hour),
+				backupTestJob("recipe-backup-hourly-1", batchv1.JobComplete, 5*time.Hour),
+				backupTestPod("recipe-backup-hourly-1", "hourly/202406150000.recipes.sql.gz"),
+				backupTestJob("recipe-backup-hourly-2", batchv1.JobFailed, 150*time.Minute),
+				backupTestJob("recipe-backup-hourly-3", batchv1.JobFailed, 90*time.Minute),
+				backupTestJob("recipe-backup-hourly-4", batchv1.JobFailed, 30*time.Minute),
+			},
+			wantStatus:              metav1.ConditionFalse,
+			wantReason:              "BackupOverdue",
+			wantConsecutiveFailures: 3,
+			wantLatestBackup:        "hourly/202406150000.recipes.sql.gz",
+		},
+		{
+			name: "pre-upgrade backup not accounted",
+			objects: []client.Object{
+				backupTestCronJob(5 * time.Hour),
+				backupTestPreUpgradeJob(batchv1.JobComplete, 30*time.Minute),
+				backupTestPod("recipe-pre-upgrade-backup", "pre-upgrade/202406150000.recipes.sql.gz"),
+			},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "BackupOverdue",
+		},
+		{
+			name: "failed pre-upgrade backup not accounted",
+			objects: []client.Object{
+				backupTestCronJob(5 * time.Hour),
+				backupTestJob("recipe-backup-hourly-1", batchv1.JobComplete, 30*time.Minute),
+				backupTestPod("recipe-backup-hourly-1", "hourly/202406150000.recipes.sql.gz"),
+				backupTestPreUpgradeJob(batchv1.JobFailed, 10*time.Minute),
+			},
+			wantStatus:       metav1.ConditionTrue,
+			wantReason:       "BackupSucceeded",
+			wantLatestBackup: "hourly/202406150000.recipes.sql.gz",
+		},
+		{
+			name: "failures already accounted",
+			status: &devconfczv1alpha1.BackupStatus{
+				LastFailedTime:      &lastFailed,
+				ConsecutiveFailures: 1,
+			},
+			objects: []client.Object{
+				backupTestCronJob(2 * time.Hour),
+				backupTestJob("recipe-backup-hourly-1", batchv1.JobFailed, 90*time.Minute),
+				backupTestJob("recipe-backup-hourly-2", batchv1.JobFailed, 30*time.Minute),
+			},
+			wantStatus:              metav1.ConditionUnknown,
+			wantReason:              "AwaitingBackup",
+			wantConsecutiveFailures: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipe := &devconfczv1alpha1.Recipe{
+				ObjectMeta: metav1.ObjectMeta{Name: "recipe", Namespace: "default"},
+				Status:     devconfczv1alpha1.RecipeStatus{Backup: tt.status},
+			}
+			recipe.Spec.Database.BackupPolicy.UnhealthyAfterIntervals = tt.unhealthyAfterIntervals
+			if len(tt.objects) > 0 {
+				recipe.Spec.Database.BackupPolicy.Schedules = []devconfczv1alpha1.BackupScheduleSpec{
+					{Name: "hourly", Schedule: "0 * * * *"},
+				}
+			}
+			r := newFakeRecipeReconciler(newTestScheme(t), tt.objects...)
+
+			if _, err := r.setBackupStatus(context.Background(), recipe); err != nil {
+				t.Fatalf("setBackupStatus() error = %v", err)
+			}
+
+			condition := meta.FindStatusCondition(recipe.Status.Conditions, typeBackupHealthyRecipe)
+			if tt.wantStatus == "" {
+				if condition != nil {
+					t.Errorf("condition %s = %v, want none", typeBackupHealthyRecipe, condition)
+				}
+				if recipe.Status.Backup != nil {
+					t.Errorf("status.backup = %v, want nil", recipe.Status.Backup)
+				}
+				return
+			}
+			if condition == nil {
+				t.Fatalf("condition %s not set", typeBackupHealthyRecipe)
+			}
+			if condition.Status != tt.wantStatus || condition.Reason != tt.wantReason {
+				t.Errorf("condition %s = %s/%s, want %s/%s", typeBackupHealthyRecipe,
+					condition.Status, condition.Reason, tt.wantStatus, tt.wantReason)
+			}
+			if got := recipe.Status.Backup.ConsecutiveFailures; got != tt.wantConsecutiveFailures {
+				t.Errorf("status.backup.consecutiveFailures = %d, want %d", got, tt.wantConsecutiveFailures)
+			}
+			if got := recipe.Status.Backup.LatestBackup; got != tt.wantLatestBackup {
+				t.Errorf("status.backup.latestBackup = %q, want %q", got, tt.wantLatestBackup)
+			}
+		})
+	}
+}
+
+func TestFinishedJobs(t *testing.T) {
+	running := backupTestJob("running", batchv1.JobComplete, 0)
+	running.Status.Conditions = nil
+	suspended := backupTestJob("suspended", batchv1.JobSuspended, time.Minute)
+	notComplete := backupTestJob("not-complete", batchv1.JobComplete, time.Minute)
+	notComplete.Status.Conditions[0].Status = corev1.ConditionFalse
+
+	jobs := []batchv1.Job{
+		*backupTestJob("old", batchv1.JobComplete, 3*time.Hour),
+		*running,
+		*backupTestJob("latest", batchv1.JobFailed, time.Hour),
+		*suspended,
+		*notComplete,
+		*backupTestJob("middle", batchv1.JobComplete, 2*time.Hour),
+	}
+	finished := finishedJobs(jobs)
+
+	want := []struct {
+		name      string
+		succeeded bool
+	}{
+		{"latest", false},
+		{"middle", true},
+		{"old", true},
+	}
+	if len(finished) != len(want) {
+		t.Fatalf("finishedJobs() returned %d jobs, want %d", len(finished), len(want))
+	}
+	for i, w := range want {
+		if finished[i].job.Name != w.name || finished[i].succeeded != w.succeeded {
+			t.Errorf("finishedJobs()[%d] = %s succeeded %v, want %s succeeded %v", i,
+				finished[i].job.Name, finished[i].succeeded, w.name, w.succeeded)
+		}
+	}
+}
+
+func TestShortestScheduleInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedules []string
+		want      time.Duration
+	}{
+		{name: "no schedule", want: 0},
+		{name: "daily", schedules: []string{"0 1 * * *"}, want: 24 * time.Hour},
+		{name: "most frequent", schedules: []string{"0 1 * * 0", "0 * * * *", "0 1 * * *"}, want: time.Hour},
+		{name: "invalid schedule ignored", schedules: []string{"not a schedule", "*/15 * * * *"}, want: 15 * time.Minute},
+		{name: "only invalid schedules", schedules: []string{"not a schedule"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedules := []devconfczv1alpha1.BackupScheduleSpec{}
+			for _, schedule := range tt.schedules {
+				schedules = append(schedules, devconfczv1alpha1.BackupScheduleSpec{Schedule: schedule})
+			}
+			if got := shortestScheduleInterval(schedules); got != tt.want {
+				t.Errorf("shortestScheduleInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
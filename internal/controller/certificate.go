@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+const (
+	// defaultCertificateValidity is the validity of a generated certificate when no validity is set
+	defaultCertificateValidity = 90 * 24 * time.Hour
+	// defaultCertificateRenewBefore is how long before its expiry a generated certificate is renewed when renewBefore is not set
+	defaultCertificateRenewBefore = 30 * 24 * time.Hour
+)
+
+// reconcileCertificates issues the serving certificate of
+// spec.expose.tls.generate and the MySQL server certificate of
+// spec.database.tls, signed by the self-signed CA of the recipe, renews them
+// and the CA before they expire and returns when the next renewal is due.
+func (r *RecipeReconciler) reconcileCertificates(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (time.Duration, error) {
+	expose := recipe.Spec.Expose != nil && recipe.Spec.Expose.TLS != nil && recipe.Spec.Expose.TLS.Generate
+	database := resources.DatabaseTLSEnabled(recipe)
+	if !expose && !database {
+		if err := r.setCertificateStatus(ctx, recipe, nil); err != nil {
+			return 0, err
+		}
+		return 0, r.setDatabaseCertificateStatus(ctx, recipe, nil)
+	}
+	now := time.Now()
+
+	caSecret, ca, caRenewed, err := r.reconcileCA(ctx, recipe, now)
+	if err != nil {
+		return 0, err
+	}
+	renewal := renewalTime(ca, resources.CARenewBefore)
+
+	var status *devconfczv1alpha1.CertificateStatus
+	if expose {
+		tls := recipe.Spec.Expose.TLS
+		status, err = r.reconcileServingCertificate(ctx, recipe, caSecret, ca, caRenewed, resources.TLSSecretName(recipe),
+			resources.CertificateDNSNames(recipe), tls.Validity, tls.RenewBefore, now)
+		if err != nil {
+			return 0, err
+		}
+		if status.RenewalTime.Time.Before(renewal) {
+			renewal = status.RenewalTime.Time
+		}
+	}
+	if err := r.setCertificateStatus(ctx, recipe, status); err != nil {
+		return 0, err
+	}
+
+	status = nil
+	if database {
+		tls := recipe.Spec.Database.TLS
+		status, err = r.reconcileServingCertificate(ctx, recipe, caSecret, ca, caRenewed, resources.MySQLTLSSecretName(recipe),
+			resources.MySQLCertificateDNSNames(recipe), tls.Validity, tls.RenewBefore, now)
+		if err != nil {
+			return 0, err
+		}
+		if status.RenewalTime.Time.Before(renewal) {
+			renewal = status.RenewalTime.Time
+		}
+	}
+	if err := r.setDatabaseCertificateStatus(ctx, recipe, status); err != nil {
+		return 0, err
+	}
+	return time.Until(renewal), nil
+}
+
+// reconcileCA returns the Secret and the certificate of the self-signed CA of
+// the recipe, which is generated again when it is due for renewal
+func (r *RecipeReconciler) reconcileCA(ctx context.Context, recipe *devconfczv1alpha1.Recipe, now time.Time) (*corev1.Secret, *x509.Certificate, bool, error) {
+	log := log.FromContext(ctx)
+
+	caSecret, err := r.getCertificateSecret(ctx, recipe, resources.CASecretName(recipe))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if caSecret != nil {
+		ca, err := resources.ParseCertificate(caSecret.Data[corev1.TLSCertKey])
+		if err == nil && now.Before(renewalTime(ca, resources.CARenewBefore)) {
+			return caSecret, ca, false, nil
+		}
+	}
+
+	log.Info("Generating CA", "Secret.Namespace", recipe.Namespace, "Secret.Name", resources.CASecretName(recipe))
+	certPEM, keyPEM, err := resources.GenerateCA(recipe, now)
+	if err != nil {
+		log.Error(err, "Failed to generate CA for recipe")
+		return nil, nil, false, err
+	}
+	caSecret, err = r.applyCertificateSecret(ctx, recipe, caSecret, resources.CASecretName(recipe), certPEM, keyPEM, certPEM)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	ca, err := resources.ParseCertificate(certPEM)
+	return caSecret, ca, true, err
+}
+
+// reconcileServingCertificate issues a serving certificate for the DNS names
+// into the Secret again when the CA or the names changed, or when it is due
+// for renewal, and returns its status
+func (r *RecipeReconciler) reconcileServingCertificate(ctx context.Context, recipe *devconfczv1alpha1.Recipe, caSecret *corev1.Secret, ca *x509.Certificate, caRenewed bool,
+	name string, dnsNames []string, validity, renewBefore *metav1.Duration, now time.Time) (*devconfczv1alpha1.CertificateStatus, error) {
+	log := log.FromContext(ctx)
+
+	certificateValidity := defaultCertificateValidity
+	if validity != nil {
+		certificateValidity = validity.Duration
+	}
+	certificateRenewBefore := defaultCertificateRenewBefore
+	if renewBefore != nil {
+		certificateRenewBefore = renewBefore.Duration
+	}
+
+	secret, err := r.getCertificateSecret(ctx, recipe, name)
+	if err != nil {
+		return nil, err
+	}
+	var cert *x509.Certificate
+	if secret != nil && !caRenewed {
+		cert, err = resources.ParseCertificate(secret.Data[corev1.TLSCertKey])
+		if err != nil || cert.CheckSignatureFrom(ca) != nil || !equality.Semantic.DeepEqual(cert.DNSNames, dnsNames) {
+			cert = nil
+		}
+	}
+	if cert == nil || !now.Before(renewalTime(cert, certificateRenewBefore)) {
+		log.Info("Issuing serving certificate", "Secret.Namespace", recipe.Namespace, "Secret.Name", name)
+		certPEM, keyPEM, err := resources.IssueServingCertificate(dnsNames, caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey], certificateValidity, now)
+		if err != nil {
+			log.Error(err, "Failed to issue serving certificate for recipe")
+			return nil, err
+		}
+		if _, err := r.applyCertificateSecret(ctx, recipe, secret, name, certPEM, keyPEM, caSecret.Data[corev1.TLSCertKey]); err != nil {
+			return nil, err
+		}
+		if cert, err = resources.ParseCertificate(certPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	notAfter := metav1.NewTime(cert.NotAfter)
+	renewal := metav1.NewTime(renewalTime(cert, certificateRenewBefore))
+	caNotAfter := metav1.NewTime(ca.NotAfter)
+	return &devconfczv1alpha1.CertificateStatus{
+		SecretName:  name,
+		NotAfter:    &notAfter,
+		RenewalTime: &renewal,
+		CANotAfter:  &caNotAfter,
+	}, nil
+}
+
+// renewalTime returns when a certificate is renewed, renewBefore its expiry.
+// The CRD keeps renewBefore shorter than the validity of new certificates.
+func renewalTime(cert *x509.Certificate, renewBefore time.Duration) time.Time {
+	// The status only keeps seconds
+	return cert.NotAfter.Add(-renewBefore).Truncate(time.Second)
+}
+
+// getCertificateSecret returns the Secret of a generated certificate, nil when
+// it does not exist yet. A Secret which is not owned by the recipe is never
+// overwritten.
+func (r *RecipeReconciler) getCertificateSecret(ctx context.Context, recipe *devconfczv1alpha1.Recipe, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: recipe.Namespace}, secret)
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to get Secret", "Secret.Namespace", recipe.Namespace, "Secret.Name", name)
+		return nil, err
+	}
+	if !metav1.IsControlledBy(secret, recipe) {
+		err := fmt.Errorf("secret %s is not owned by recipe %s, set another spec.expose.tls.secretName", name, recipe.Name)
+		log.FromContext(ctx).Error(err, "Failed to generate certificate", "Secret.Namespace", recipe.Namespace, "Secret.Name", name)
+		return nil, err
+	}
+	return secret, nil
+}
+
+// applyCertificateSecret creates or updates the Secret of a generated certificate
+func (r *RecipeReconciler) applyCertificateSecret(ctx context.Context, recipe *devconfczv1alpha1.Recipe, found *corev1.Secret, name string, certPEM, keyPEM, caPEM []byte) (*corev1.Secret, error) {
+	log := log.FromContext(ctx)
+
+	secret, err := resources.SecretForCertificate(recipe, name, certPEM, keyPEM, caPEM, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define certificate Secret for recipe")
+		return nil, err
+	}
+	if found == nil {
+		log.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			log.Error(err, "Failed to create new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return nil, err
+		}
+		return secret, nil
+	}
+	found.Data = secret.Data
+	if err := r.Update(ctx, found); err != nil {
+		log.Error(err, "Failed to update Secret", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+		return nil, err
+	}
+	return found, nil
+}
+
+// setDatabaseCertificateStatus updates status.databaseCertificate when it changed
+func (r *RecipeReconciler) setDatabaseCertificateStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.CertificateStatus) error {
+	if equality.Semantic.DeepEqual(recipe.Status.DatabaseCertificate, status) {
+		return nil
+	}
+	recipe.Status.DatabaseCertificate = status
+	if err := r.Status().Update(ctx, recipe); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update recipe status")
+		return err
+	}
+	return nil
+}
+
+// setCertificateStatus updates status.certificate when it changed
+func (r *RecipeReconciler) setCertificateStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.CertificateStatus) error {
+	if equality.Semantic.DeepEqual(recipe.Status.Certificate, status) {
+		return nil
+	}
+	recipe.Status.Certificate = status
+	if err := r.Status().Update(ctx, recipe); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update recipe status")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// withConfigChecksum sets the checksum of the ConfigMaps and Secrets the
+// environment variables of the Deployment are read from on its pod template.
+// Missing objects are left out, the pods cannot start without them anyway.
+func (r *RecipeReconciler) withConfigChecksum(ctx context.Context, dep *appsv1.Deployment) error {
+	log := log.FromContext(ctx)
+
+	configMapNames, secretNames := resources.EnvReferences(&dep.Spec.Template.Spec)
+	configMaps := []*corev1.ConfigMap{}
+	for _, name := range configMapNames {
+		configMap := &corev1.ConfigMap{}
+		err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: dep.Namespace}, configMap)
+		if err != nil && apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			log.Error(err, "Failed to get ConfigMap", "ConfigMap.Namespace", dep.Namespace, "ConfigMap.Name", name)
+			return err
+		}
+		configMaps = append(configMaps, configMap)
+	}
+	secrets := []*corev1.Secret{}
+	for _, name := range secretNames {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: dep.Namespace}, secret)
+		if err != nil && apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			log.Error(err, "Failed to get Secret", "Secret.Namespace", dep.Namespace, "Secret.Name", name)
+			return err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	resources.WithConfigChecksum(&dep.Spec.Template, resources.ConfigChecksum(configMaps, secrets))
+	return nil
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// clonePendingRetry is how often a Recipe which cannot be cloned yet is checked again
+const clonePendingRetry = 30 * time.Second
+
+// cloneFromRecipe copies the database of spec.source.fromRecipe and reports
+// whether the clone completed, or when it should be checked again.
+func (r *RecipeReconciler) cloneFromRecipe(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (bool, time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	ref := recipe.Spec.Source.FromRecipe
+	if ref.Namespace == "" {
+		ref.Namespace = recipe.Namespace
+	}
+	status := &devconfczv1alpha1.CloneStatus{Source: ref.Namespace + "/" + ref.Name}
+	if recipe.Status.Clone != nil && recipe.Status.Clone.Source == status.Source {
+		status = recipe.Status.Clone.DeepCopy()
+	}
+	if status.Phase == devconfczv1alpha1.ClonePhaseCompleted {
+		return true, 0, nil
+	}
+	pending := func(message string) (bool, time.Duration, error) {
+		status.Phase = devconfczv1alpha1.ClonePhasePending
+		status.Message = message
+		return false, clonePendingRetry, r.setCloneStatus(ctx, recipe, status)
+	}
+
+	job, err := resources.JobForClone(recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define Clone Job for recipe")
+		return false, 0, err
+	}
+	foundJob := &batchv1.Job{}
+	err = r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, foundJob)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to get Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return false, 0, err
+	} else if err == nil {
+		now := metav1.Now()
+		switch {
+		case jobConditionTrue(foundJob, batchv1.JobComplete):
+			// The copied credentials of the source are no longer needed
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: recipe.Name + "-clone-source", Namespace: recipe.Namespace}}
+			if err := r.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+				log.Error(err, "Failed to delete clone source Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+				return false, 0, err
+			}
+			status.Phase = devconfczv1alpha1.ClonePhaseCompleted
+			status.CompletionTime = &now
+			status.Message = fmt.Sprintf("Cloned the database of Recipe %s", status.Source)
+			return true, 0, r.setCloneStatus(ctx, recipe, status)
+		case jobConditionTrue(foundJob, batchv1.JobFailed):
+			status.Phase = devconfczv1alpha1.ClonePhaseFailed
+			status.Message = fmt.Sprintf("Job %s failed to clone the database, delete it to retry", foundJob.Name)
+			return false, 0, r.setCloneStatus(ctx, recipe, status)
+		}
+		// The Job is still running, its status changes will trigger a new reconcile
+		return false, 0, nil
+	}
+
+	// Check the source Recipe exists and allows to be cloned into this namespace
+	source := &devconfczv1alpha1.Recipe{}
+	err = r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: ref.Namespace}, source)
+	if err != nil && apierrors.IsNotFound(err) {
+		return pending(fmt.Sprintf("Recipe %s not found", status.Source))
+	} else if err != nil {
+		log.Error(err, "Failed to get source recipe", "Recipe.Namespace", ref.Namespace, "Recipe.Name", ref.Name)
+		return false, 0, err
+	}
+	if !cloneAllowed(source, recipe.Namespace) {
+		return pending(fmt.Sprintf("Recipe %s does not allow to be cloned into namespace %s, see spec.cloneAllowedNamespaces", status.Source, recipe.Namespace))
+	}
+
+	// Copy the connection to the source database next to the clone Job
+	sourceConfigMap := &corev1.ConfigMap{}
+	err = r.Get(ctx, client.ObjectKey{Name: source.Name + "-mysql-config", Namespace: source.Namespace}, sourceConfigMap)
+	if err != nil && apierrors.IsNotFound(err) {
+		return pending(fmt.Sprintf("The database of Recipe %s is not provisioned yet", status.Source))
+	} else if err != nil {
+		log.Error(err, "Failed to get source ConfigMap", "ConfigMap.Namespace", source.Namespace)
+		return false, 0, err
+	}
+	sourceSecret := &corev1.Secret{}
+	err = r.Get(ctx, client.ObjectKey{Name: source.Name + "-mysql", Namespace: source.Namespace}, sourceSecret)
+	if err != nil && apierrors.IsNotFound(err) {
+		return pending(fmt.Sprintf("The database of Recipe %s is not provisioned yet", status.Source))
+	} else if err != nil {
+		log.Error(err, "Failed to get source Secret", "Secret.Namespace", source.Namespace)
+		return false, 0, err
+	}
+	secret, err := resources.SecretForClone(recipe, source, sourceConfigMap, sourceSecret, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define clone source Secret for recipe")
+		return false, 0, err
+	}
+	foundSecret := &corev1.Secret{}
+	err = r.Get(ctx, client.ObjectKey{Name: secret.Name, Namespace: secret.Namespace}, foundSecret)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			log.Error(err, "Failed to create new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return false, 0, err
+		}
+	} else if err != nil {
+		log.Error(err, "Failed to get Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		return false, 0, err
+	} else if !equality.Semantic.DeepEqual(foundSecret.Data, secret.Data) {
+		foundSecret.Data = secret.Data
+		if err := r.Update(ctx, foundSecret); err != nil {
+			log.Error(err, "Failed to update Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return false, 0, err
+		}
+	}
+
+	log.Info("Creating a new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+	if err := r.Create(ctx, job); err != nil {
+		log.Error(err, "Failed to create new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return false, 0, err
+	}
+	now := metav1.Now()
+	status.Phase = devconfczv1alpha1.ClonePhaseCloning
+	status.StartTime = &now
+	status.Message = fmt.Sprintf("Job %s is copying the database of Recipe %s", job.Name, status.Source)
+	return false, 0, r.setCloneStatus(ctx, recipe, status)
+}
+
+// setCloneStatus updates status.clone when it changed
+func (r *RecipeReconciler) setCloneStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.CloneStatus) error {
+	if equality.Semantic.DeepEqual(recipe.Status.Clone, status) {
+		return nil
+	}
+	recipe.Status.Clone = status
+	if err := r.Status().Update(ctx, recipe); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update recipe status")
+		return err
+	}
+	return nil
+}
+
+// cloneAllowed reports whether the Recipes of a namespace may clone the source Recipe
+func cloneAllowed(source *devconfczv1alpha1.Recipe, namespace string) bool {
+	if source.Namespace == namespace {
+		return true
+	}
+	for _, allowed := range source.Spec.CloneAllowedNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// typeWaitingForDatabaseRecipe represents whether the recipe app is held until the database is ready
+const typeWaitingForDatabaseRecipe = "WaitingForDatabase"
+
+// databaseReady reports whether the MySQL Deployment is available and the
+// initRestore Job, if any, succeeded, so that the recipe app can be deployed.
+// Changes of the Deployment and of the Job trigger a new reconcile.
+func (r *RecipeReconciler) databaseReady(ctx context.Context, recipe *devconfczv1alpha1.Recipe, mysqlDep *appsv1.Deployment) (bool, error) {
+	log := log.FromContext(ctx)
+
+	if !deploymentRolledOut(mysqlDep) {
+		return false, r.setWaitingForDatabaseCondition(ctx, recipe, metav1.ConditionTrue, "DatabaseNotAvailable",
+			fmt.Sprintf("Deployment %s is not available yet", mysqlDep.Name))
+	}
+
+	if recipe.Spec.Database.InitRestore {
+		job, err := resources.JobForMySqlRestore(recipe, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define Restore Job for recipe")
+			return false, err
+		}
+		foundJob := &batchv1.Job{}
+		err = r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, foundJob)
+		if err != nil && apierrors.IsNotFound(err) {
+			log.Info("Creating a new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			err = r.Create(ctx, job)
+			if err != nil {
+				log.Error(err, "Failed to create new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+				return false, err
+			}
+			return false, r.setWaitingForDatabaseCondition(ctx, recipe, metav1.ConditionTrue, "InitRestoreRunning",
+				fmt.Sprintf("Job %s is restoring the latest backup", job.Name))
+		} else if err != nil {
+			log.Error(err, "Failed to get Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return false, err
+		}
+
+		switch {
+		case jobConditionTrue(foundJob, batchv1.JobFailed):
+			return false, r.setWaitingForDatabaseCondition(ctx, recipe, metav1.ConditionTrue, "InitRestoreFailed",
+				fmt.Sprintf("Job %s failed to restore the latest backup, delete it to retry", foundJob.Name))
+		case !jobConditionTrue(foundJob, batchv1.JobComplete):
+			return false, r.setWaitingForDatabaseCondition(ctx, recipe, metav1.ConditionTrue, "InitRestoreRunning",
+				fmt.Sprintf("Job %s is restoring the latest backup", foundJob.Name))
+		}
+	}
+
+	return true, r.setWaitingForDatabaseCondition(ctx, recipe, metav1.ConditionFalse, "DatabaseReady",
+		"The database is ready")
+}
+
+// setWaitingForDatabaseCondition updates the WaitingForDatabase condition when it changed
+func (r *RecipeReconciler) setWaitingForDatabaseCondition(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status metav1.ConditionStatus, reason, message string) error {
+	current := meta.FindStatusCondition(recipe.Status.Conditions, typeWaitingForDatabaseRecipe)
+	if current != nil && current.Status == status && current.Reason == reason && current.Message == message {
+		return nil
+	}
+	meta.SetStatusCondition(&recipe.Status.Conditions, metav1.Condition{
+		Type:               typeWaitingForDatabaseRecipe,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: recipe.Generation,
+	})
+	if err := r.Status().Update(ctx, recipe); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update recipe status")
+		return err
+	}
+	return nil
+}
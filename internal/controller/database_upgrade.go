@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// upgradePollInterval is how often the rollout of MySQL and the scaling of
+// the recipe app are checked during an upgrade
+const upgradePollInterval = 5 * time.Second
+
+// upgradeDatabase drives a change of spec.database.image: the database is
+// backed up, the recipe app scaled down, MySQL restarted with the new image
+// and checked by mysql_upgrade before the app is scaled back. When MySQL does
+// not start or the check fails, MySQL is restarted with the previous image on
+// an empty volume and the backup is restored. It reports whether the rest of
+// the Recipe can be reconciled, or when the upgrade should be checked again.
+func (r *RecipeReconciler) upgradeDatabase(ctx context.Context, recipe *devconfczv1alpha1.Recipe, mysqlDep *appsv1.Deployment, image string) (bool, time.Duration, error) {
+	log := log.FromContext(ctx)
+	running := mysqlDep.Spec.Template.Spec.Containers[0].Image
+
+	var status *devconfczv1alpha1.DatabaseUpgradeStatus
+	if recipe.Status.DatabaseUpgrade != nil {
+		status = recipe.Status.DatabaseUpgrade.DeepCopy()
+	}
+	if status == nil || upgradeFinished(status) {
+		if running == image {
+			// Setting the image back after a failed upgrade allows to try it again
+			if status != nil && status.Phase != devconfczv1alpha1.DatabaseUpgradePhaseCompleted {
+				return true, 0, r.setDatabaseUpgradeStatus(ctx, recipe, nil)
+			}
+			return true, 0, nil
+		}
+		// A failed upgrade is not retried until spec.database.image changes again
+		if status != nil && status.ToImage == image && status.Phase != devconfczv1alpha1.DatabaseUpgradePhaseCompleted {
+			return status.Phase != devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed, 0, nil
+		}
+
+		// Remove the Jobs of a previous upgrade before starting a new one
+		for _, name := range []string{"-pre-upgrade-backup", "-upgrade", "-upgrade-wipe", "-upgrade-rollback"} {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: recipe.Name + name, Namespace: recipe.Namespace}}
+			if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+				log.Error(err, "Failed to delete Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+				return false, 0, err
+			}
+		}
+		now := metav1.Now()
+		log.Info("Upgrading MySQL", "From", running, "To", image)
+		return false, upgradePollInterval, r.setDatabaseUpgradeStatus(ctx, recipe, &devconfczv1alpha1.DatabaseUpgradeStatus{
+			FromImage: running,
+			ToImage:   image,
+			Phase:     devconfczv1alpha1.DatabaseUpgradePhaseBackingUp,
+			StartTime: &now,
+			Message:   "Backing up the database before the upgrade",
+		})
+	}
+
+	switch status.Phase {
+	case devconfczv1alpha1.DatabaseUpgradePhaseBackingUp:
+		job, err := resources.JobForPreUpgradeBackup(recipe, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define pre-upgrade backup Job for recipe")
+			return false, 0, err
+		}
+		foundJob, err := r.runUpgradeJob(ctx, job)
+		if err != nil || foundJob == nil {
+			return false, 0, err
+		}
+		if jobConditionTrue(foundJob, batchv1.JobFailed) {
+			return r.finishDatabaseUpgrade(ctx, recipe, status, devconfczv1alpha1.DatabaseUpgradePhaseFailed,
+				fmt.Sprintf("Job %s failed to back the database up, MySQL was not upgraded", foundJob.Name))
+		}
+		if !jobConditionTrue(foundJob, batchv1.JobComplete) {
+			return false, 0, nil
+		}
+		backup, err := r.jobTerminationMessage(ctx, foundJob)
+		if err != nil {
+			log.Error(err, "Failed to get the pre-upgrade backup", "Job.Name", foundJob.Name)
+			return false, 0, err
+		}
+		status.Backup = backup
+		status.Phase = devconfczv1alpha1.DatabaseUpgradePhaseScalingDown
+		status.Message = "Scaling down the recipe app"
+		return false, upgradePollInterval, r.setDatabaseUpgradeStatus(ctx, recipe, status)
+
+	case devconfczv1alpha1.DatabaseUpgradePhaseScalingDown:
+		scaledDown, err := r.scaleRecipeApp(ctx, recipe, 0)
+		if err != nil || !scaledDown {
+			return false, upgradePollInterval, err
+		}
+		log.Info("Restarting MySQL with the new image", "Deployment.Name", mysqlDep.Name, "Image", status.ToImage)
+		resources.SetMySQLImage(&mysqlDep.Spec.Template.Spec, status.ToImage)
+		if err := r.Update(ctx, mysqlDep); err != nil {
+			log.Error(err, "Failed to update mysql database deployment", "Deployment.Namespace", mysqlDep.Namespace, "Deployment.Name", mysqlDep.Name)
+			return false, 0, err
+		}
+		status.Phase = devconfczv1alpha1.DatabaseUpgradePhaseUpgrading
+		status.Message = fmt.Sprintf("Restarting MySQL with %s", status.ToImage)
+		return false, upgradePollInterval, r.setDatabaseUpgradeStatus(ctx, recipe, status)
+
+	case devconfczv1alpha1.DatabaseUpgradePhaseUpgrading:
+		if deploymentProgressFailed(mysqlDep) {
+			return r.rollbackDatabaseUpgrade(ctx, recipe, status, fmt.Sprintf("MySQL did not start with %s", status.ToImage))
+		}
+		if !deploymentRolledOut(mysqlDep) {
+			return false, upgradePollInterval, nil
+		}
+		job, err := resources.JobForDatabaseUpgrade(recipe, status.ToImage, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define upgrade Job for recipe")
+			return false, 0, err
+		}
+		if _, err := r.runUpgradeJob(ctx, job); err != nil {
+			return false, 0, err
+		}
+		status.Phase = devconfczv1alpha1.DatabaseUpgradePhaseVerifying
+		status.Message = fmt.Sprintf("Job %s is upgrading and checking the tables", job.Name)
+		return false, 0, r.setDatabaseUpgradeStatus(ctx, recipe, status)
+
+	case devconfczv1alpha1.DatabaseUpgradePhaseVerifying:
+		job, err := resources.JobForDatabaseUpgrade(recipe, status.ToImage, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define upgrade Job for recipe")
+			return false, 0, err
+		}
+		foundJob, err := r.runUpgradeJob(ctx, job)
+		if err != nil || foundJob == nil {
+			return false, 0, err
+		}
+		if jobConditionTrue(foundJob, batchv1.JobFailed) {
+			message, err := r.jobTerminationMessage(ctx, foundJob)
+			if err != nil {
+				log.Error(err, "Failed to get the termination message of the upgrade Job", "Job.Name", foundJob.Name)
+				return false, 0, err
+			}
+			if message == "" {
+				message = fmt.Sprintf("Job %s failed", foundJob.Name)
+			}
+			return r.rollbackDatabaseUpgrade(ctx, recipe, status, message)
+		}
+		if !jobConditionTrue(foundJob, batchv1.JobComplete) {
+			return false, 0, nil
+		}
+		if _, err := r.scaleRecipeApp(ctx, recipe, recipe.Spec.Replicas); err != nil {
+			return false, 0, err
+		}
+		return r.finishDatabaseUpgrade(ctx, recipe, status, devconfczv1alpha1.DatabaseUpgradePhaseCompleted,
+			fmt.Sprintf("Upgraded MySQL from %s to %s", status.FromImage, status.ToImage))
+
+	case devconfczv1alpha1.DatabaseUpgradePhaseRollingBack:
+		// Stop MySQL before its data files are removed
+		if mysqlDep.Spec.Template.Spec.Containers[0].Image != status.FromImage || mysqlDep.Spec.Replicas == nil || *mysqlDep.Spec.Replicas != 0 {
+			log.Info("Stopping MySQL to roll the upgrade back", "Deployment.Name", mysqlDep.Name)
+			resources.SetMySQLImage(&mysqlDep.Spec.Template.Spec, status.FromImage)
+			mysqlDep.Spec.Replicas = &[]int32{0}[0]
+			if err := r.Update(ctx, mysqlDep); err != nil {
+				log.Error(err, "Failed to update mysql database deployment", "Deployment.Namespace", mysqlDep.Namespace, "Deployment.Name", mysqlDep.Name)
+				return false, 0, err
+			}
+		}
+		pods := &corev1.PodList{}
+		if err := r.List(ctx, pods, client.InNamespace(recipe.Namespace), client.MatchingLabels(mysqlDep.Spec.Selector.MatchLabels)); err != nil {
+			log.Error(err, "Failed to list mysql database pods")
+			return false, 0, err
+		}
+		if len(pods.Items) != 0 {
+			return false, upgradePollInterval, nil
+		}
+
+		job, err := resources.JobForDatabaseWipe(recipe, status.FromImage, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define wipe Job for recipe")
+			return false, 0, err
+		}
+		foundJob, err := r.runUpgradeJob(ctx, job)
+		if err != nil || foundJob == nil {
+			return false, 0, err
+		}
+		if jobConditionTrue(foundJob, batchv1.JobFailed) {
+			return r.finishDatabaseUpgrade(ctx, recipe, status, devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed,
+				fmt.Sprintf("Job %s failed to empty the MySQL volume, the recipe app is kept scaled down", foundJob.Name))
+		}
+		if !jobConditionTrue(foundJob, batchv1.JobComplete) {
+			return false, 0, nil
+		}
+		log.Info("Restarting MySQL with the previous image", "Deployment.Name", mysqlDep.Name, "Image", status.FromImage)
+		mysqlDep.Spec.Replicas = &[]int32{1}[0]
+		if err := r.Update(ctx, mysqlDep); err != nil {
+			log.Error(err, "Failed to update mysql database deployment", "Deployment.Namespace", mysqlDep.Namespace, "Deployment.Name", mysqlDep.Name)
+			return false, 0, err
+		}
+		// The message keeps the reason of the rollback
+		status.Phase = devconfczv1alpha1.DatabaseUpgradePhaseRestoring
+		return false, upgradePollInterval, r.setDatabaseUpgradeStatus(ctx, recipe, status)
+
+	case devconfczv1alpha1.DatabaseUpgradePhaseRestoring:
+		if !deploymentRolledOut(mysqlDep) {
+			return false, upgradePollInterval, nil
+		}
+		job, err := resources.JobForUpgradeRollback(recipe, status.Backup, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define rollback Job for recipe")
+			return false, 0, err
+		}
+		foundJob, err := r.runUpgradeJob(ctx, job)
+		if err != nil || foundJob == nil {
+			return false, 0, err
+		}
+		if jobConditionTrue(foundJob, batchv1.JobFailed) {
+			return r.finishDatabaseUpgrade(ctx, recipe, status, devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed,
+				fmt.Sprintf("Job %s failed to restore %s, the recipe app is kept scaled down", foundJob.Name, status.Backup))
+		}
+		if !jobConditionTrue(foundJob, batchv1.JobComplete) {
+			return false, 0, nil
+		}
+		if _, err := r.scaleRecipeApp(ctx, recipe, recipe.Spec.Replicas); err != nil {
+			return false, 0, err
+		}
+		return r.finishDatabaseUpgrade(ctx, recipe, status, devconfczv1alpha1.DatabaseUpgradePhaseRolledBack,
+			fmt.Sprintf("%s, rolled back to %s and restored %s", status.Message, status.FromImage, status.Backup))
+	}
+
+	return false, 0, nil
+}
+
+// rollbackDatabaseUpgrade starts rolling back a failed upgrade
+func (r *RecipeReconciler) rollbackDatabaseUpgrade(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.DatabaseUpgradeStatus, message string) (bool, time.Duration, error) {
+	log.FromContext(ctx).Info("Rolling back the MySQL upgrade", "Reason", message)
+	status.Phase = devconfczv1alpha1.DatabaseUpgradePhaseRollingBack
+	status.Message = message
+	return false, upgradePollInterval, r.setDatabaseUpgradeStatus(ctx, recipe, status)
+}
+
+// finishDatabaseUpgrade records the terminal phase of an upgrade, a failed
+// rollback keeps the rest of the Recipe from being reconciled
+func (r *RecipeReconciler) finishDatabaseUpgrade(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.DatabaseUpgradeStatus, phase devconfczv1alpha1.DatabaseUpgradePhase, message string) (bool, time.Duration, error) {
+	now := metav1.Now()
+	status.Phase = phase
+	status.Message = message
+	status.CompletionTime = &now
+	err := r.setDatabaseUpgradeStatus(ctx, recipe, status)
+	return err == nil && phase != devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed, 0, err
+}
+
+// setDatabaseUpgradeStatus updates status.databaseUpgrade when it changed
+func (r *RecipeReconciler) setDatabaseUpgradeStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.DatabaseUpgradeStatus) error {
+	if equality.Semantic.DeepEqual(recipe.Status.DatabaseUpgrade, status) {
+		return nil
+	}
+	recipe.Status.DatabaseUpgrade = status
+	if err := r.Status().Update(ctx, recipe); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update recipe status")
+		return err
+	}
+	return nil
+}
+
+// runUpgradeJob creates the Job of an upgrade step when it does not exist
+// yet, and returns the existing Job otherwise
+func (r *RecipeReconciler) runUpgradeJob(ctx context.Context, job *batchv1.Job) (*batchv1.Job, error) {
+	log := log.FromContext(ctx)
+	foundJob := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, foundJob)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			log.Error(err, "Failed to create new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return nil, err
+		}
+		return nil, nil
+	} else if err != nil {
+		log.Error(err, "Failed to get Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return nil, err
+	}
+	// The Job of a previous upgrade is still being deleted
+	if foundJob.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	return foundJob, nil
+}
+
+// scaleRecipeApp scales the recipe app and reports whether it has no more
+// pods than requested
+func (r *RecipeReconciler) scaleRecipeApp(ctx context.Context, recipe *devconfczv1alpha1.Recipe, replicas int32) (bool, error) {
+	log := log.FromContext(ctx)
+	dep := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKey{Name: recipe.Name, Namespace: recipe.Namespace}, dep)
+	if err != nil && apierrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		log.Error(err, "Failed to get Recipe App Deployment")
+		return false, err
+	}
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas != replicas {
+		log.Info("Scaling Recipe App Deployment for the MySQL upgrade", "Deployment.Name", dep.Name, "Replicas", replicas)
+		dep.Spec.Replicas = &replicas
+		if err := r.Update(ctx, dep); err != nil {
+			log.Error(err, "Failed to scale Recipe App Deployment", "Deployment.Name", dep.Name)
+			return false, err
+		}
+	}
+	return dep.Status.Replicas <= replicas, nil
+}
+
+// upgradeFinished reports whether an upgrade reached a terminal phase
+func upgradeFinished(status *devconfczv1alpha1.DatabaseUpgradeStatus) bool {
+	switch status.Phase {
+	case devconfczv1alpha1.DatabaseUpgradePhaseCompleted,
+		devconfczv1alpha1.DatabaseUpgradePhaseFailed,
+		devconfczv1alpha1.DatabaseUpgradePhaseRolledBack,
+		devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed:
+		return true
+	}
+	return false
+}
+
+// deploymentRolledOut reports whether every replica of the Deployment runs its latest template
+func deploymentRolledOut(dep *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	return dep.Status.ObservedGeneration >= dep.Generation &&
+		dep.Status.UpdatedReplicas == replicas &&
+		dep.Status.AvailableReplicas == replicas &&
+		dep.Status.Replicas == replicas
+}
+
+// deploymentProgressFailed reports whether the Deployment exceeded its progress deadline
+func deploymentProgressFailed(dep *appsv1.Deployment) bool {
+	if dep.Status.ObservedGeneration < dep.Generation {
+		return false
+	}
+	for _, c := range dep.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,422 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+const (
+	upgradeTestFromImage = "mysql:8.0"
+	upgradeTestToImage   = "mysql:8.4"
+)
+
+// newTestScheme returns a scheme with the Kubernetes and the recipe types
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := devconfczv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+// newFakeRecipeReconciler returns a RecipeReconciler backed by a fake client holding the objects
+func newFakeRecipeReconciler(scheme *runtime.Scheme, objects ...client.Object) *RecipeReconciler {
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&devconfczv1alpha1.Recipe{}).
+		Build()
+	return &RecipeReconciler{Client: c, Scheme: scheme}
+}
+
+// upgradeTestJob returns a Job of an upgrade step with the given condition, if any
+func upgradeTestJob(name string, condition batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "recipe" + name, Namespace: "default"}}
+	if condition != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+	}
+	return job
+}
+
+// upgradeTestPod returns a terminated pod of a Job with the termination message
+func upgradeTestPod(job, message string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "recipe" + job + "-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{"job-name": "recipe" + job},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Message: message},
+				},
+			}},
+		},
+	}
+}
+
+func TestUpgradeDatabase(t *testing.T) {
+	rolledOut := appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	progressFailed := appsv1.DeploymentStatus{
+		Replicas: 1,
+		Conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+		},
+	}
+	upgrade := func(phase devconfczv1alpha1.DatabaseUpgradePhase) *devconfczv1alpha1.DatabaseUpgradeStatus {
+		return &devconfczv1alpha1.DatabaseUpgradeStatus{
+			FromImage: upgradeTestFromImage,
+			ToImage:   upgradeTestToImage,
+			Phase:     phase,
+			Backup:    "pre-upgrade/202406150000.recipes.sql.gz",
+			Message:   "MySQL did not start with " + upgradeTestToImage,
+		}
+	}
+
+	tests := []struct {
+		name string
+		// status is the status.databaseUpgrade of the Recipe
+		status *devconfczv1alpha1.DatabaseUpgradeStatus
+		// image is the image of the running MySQL
+		image       string
+		mysqlStatus appsv1.DeploymentStatus
+		// appReplicas is the number of pods of the recipe app
+		appReplicas int32
+		objects     []client.Object
+
+		wantProceed       bool
+		wantPhase         devconfczv1alpha1.DatabaseUpgradePhase
+		wantMySQLImage    string
+		wantMySQLReplicas int32
+		wantAppReplicas   int32
+		wantJob           string
+	}{
+		{
+			name:              "image unchanged",
+			image:             upgradeTestToImage,
+			wantProceed:       true,
+			wantMySQLImage:    upgradeTestToImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "image changed starts backing up",
+			image:             upgradeTestFromImage,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseBackingUp,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "backing up creates the backup Job",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseBackingUp),
+			image:             upgradeTestFromImage,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseBackingUp,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+			wantJob:           "-pre-upgrade-backup",
+		},
+		{
+			name:              "failed backup leaves MySQL untouched",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseBackingUp),
+			image:             upgradeTestFromImage,
+			objects:           []client.Object{upgradeTestJob("-pre-upgrade-backup", batchv1.JobFailed)},
+			wantProceed:       true,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseFailed,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:   "completed backup scales the app down",
+			status: upgrade(devconfczv1alpha1.DatabaseUpgradePhaseBackingUp),
+			image:  upgradeTestFromImage,
+			objects: []client.Object{
+				upgradeTestJob("-pre-upgrade-backup", batchv1.JobComplete),
+				upgradeTestPod("-pre-upgrade-backup", "pre-upgrade/202406150000.recipes.sql.gz"),
+			},
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseScalingDown,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "scaling down waits for the app pods",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseScalingDown),
+			image:             upgradeTestFromImage,
+			appReplicas:       2,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseScalingDown,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   0,
+		},
+		{
+			name:              "scaled down app restarts MySQL with the new image",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseScalingDown),
+			image:             upgradeTestFromImage,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseUpgrading,
+			wantMySQLImage:    upgradeTestToImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   0,
+		},
+		{
+			name:              "upgraded MySQL is checked",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseUpgrading),
+			image:             upgradeTestToImage,
+			mysqlStatus:       rolledOut,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseVerifying,
+			wantMySQLImage:    upgradeTestToImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+			wantJob:           "-upgrade",
+		},
+		{
+			name:              "MySQL not starting rolls back",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseUpgrading),
+			image:             upgradeTestToImage,
+			mysqlStatus:       progressFailed,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRollingBack,
+			wantMySQLImage:    upgradeTestToImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "successful check scales the app back",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseVerifying),
+			image:             upgradeTestToImage,
+			mysqlStatus:       rolledOut,
+			objects:           []client.Object{upgradeTestJob("-upgrade", batchv1.JobComplete)},
+			wantProceed:       true,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseCompleted,
+			wantMySQLImage:    upgradeTestToImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:   "failed check rolls back",
+			status: upgrade(devconfczv1alpha1.DatabaseUpgradePhaseVerifying),
+			image:  upgradeTestToImage,
+			objects: []client.Object{
+				upgradeTestJob("-upgrade", batchv1.JobFailed),
+				upgradeTestPod("-upgrade", "Table check failed"),
+			},
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRollingBack,
+			wantMySQLImage:    upgradeTestToImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "rolling back stops MySQL and wipes its volume",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRollingBack),
+			image:             upgradeTestToImage,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRollingBack,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 0,
+			wantAppReplicas:   2,
+			wantJob:           "-upgrade-wipe",
+		},
+		{
+			name:              "wiped volume restarts MySQL with the previous image",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRollingBack),
+			image:             upgradeTestFromImage,
+			objects:           []client.Object{upgradeTestJob("-upgrade-wipe", batchv1.JobComplete)},
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRestoring,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "failed wipe fails the rollback",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRollingBack),
+			image:             upgradeTestFromImage,
+			objects:           []client.Object{upgradeTestJob("-upgrade-wipe", batchv1.JobFailed)},
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 0,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "restarted MySQL gets the backup restored",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRestoring),
+			image:             upgradeTestFromImage,
+			mysqlStatus:       rolledOut,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRestoring,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+			wantJob:           "-upgrade-rollback",
+		},
+		{
+			name:              "restored backup completes the rollback",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRestoring),
+			image:             upgradeTestFromImage,
+			mysqlStatus:       rolledOut,
+			objects:           []client.Object{upgradeTestJob("-upgrade-rollback", batchv1.JobComplete)},
+			wantProceed:       true,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRolledBack,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "failed restore fails the rollback",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRestoring),
+			image:             upgradeTestFromImage,
+			mysqlStatus:       rolledOut,
+			objects:           []client.Object{upgradeTestJob("-upgrade-rollback", batchv1.JobFailed)},
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "failed rollback keeps the recipe from being reconciled",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed),
+			image:             upgradeTestFromImage,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRollbackFailed,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+		{
+			name:              "rolled back upgrade is not retried",
+			status:            upgrade(devconfczv1alpha1.DatabaseUpgradePhaseRolledBack),
+			image:             upgradeTestFromImage,
+			wantProceed:       true,
+			wantPhase:         devconfczv1alpha1.DatabaseUpgradePhaseRolledBack,
+			wantMySQLImage:    upgradeTestFromImage,
+			wantMySQLReplicas: 1,
+			wantAppReplicas:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			recipe := &devconfczv1alpha1.Recipe{
+				ObjectMeta: metav1.ObjectMeta{Name: "recipe", Namespace: "default"},
+				Spec: devconfczv1alpha1.RecipeSpec{
+					Replicas: 2,
+					Database: devconfczv1alpha1.DatabaseSpec{Image: upgradeTestToImage},
+				},
+				Status: devconfczv1alpha1.RecipeStatus{DatabaseUpgrade: tt.status},
+			}
+			scheme := newTestScheme(t)
+			mysqlDep, err := resources.MysqlDeploymentForRecipe(recipe, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mysqlDep.Spec.Template.Spec.Containers[0].Image = tt.image
+			mysqlDep.Spec.Replicas = &[]int32{1}[0]
+			mysqlDep.Status = tt.mysqlStatus
+			appReplicas := int32(2)
+			if tt.status != nil && tt.status.Phase == devconfczv1alpha1.DatabaseUpgradePhaseScalingDown {
+				appReplicas = 0
+				if tt.appReplicas != 0 {
+					appReplicas = tt.appReplicas
+				}
+			}
+			appDep := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "recipe", Namespace: "default"},
+				Spec:       appsv1.DeploymentSpec{Replicas: &appReplicas},
+				Status:     appsv1.DeploymentStatus{Replicas: tt.appReplicas},
+			}
+			r := newFakeRecipeReconciler(scheme, append([]client.Object{recipe, mysqlDep, appDep}, tt.objects...)...)
+
+			if err := r.Get(ctx, client.ObjectKeyFromObject(recipe), recipe); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(mysqlDep), mysqlDep); err != nil {
+				t.Fatal(err)
+			}
+			proceed, _, err := r.upgradeDatabase(ctx, recipe, mysqlDep, upgradeTestToImage)
+			if err != nil {
+				t.Fatalf("upgradeDatabase() error = %v", err)
+			}
+			if proceed != tt.wantProceed {
+				t.Errorf("upgradeDatabase() proceed = %v, want %v", proceed, tt.wantProceed)
+			}
+
+			found := &devconfczv1alpha1.Recipe{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(recipe), found); err != nil {
+				t.Fatal(err)
+			}
+			phase := devconfczv1alpha1.DatabaseUpgradePhase("")
+			if found.Status.DatabaseUpgrade != nil {
+				phase = found.Status.DatabaseUpgrade.Phase
+			}
+			if phase != tt.wantPhase {
+				t.Errorf("status.databaseUpgrade.phase = %q, want %q", phase, tt.wantPhase)
+			}
+			if tt.wantPhase == devconfczv1alpha1.DatabaseUpgradePhaseScalingDown && found.Status.DatabaseUpgrade.Backup == "" {
+				t.Errorf("status.databaseUpgrade.backup is empty")
+			}
+
+			foundMysql := &appsv1.Deployment{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(mysqlDep), foundMysql); err != nil {
+				t.Fatal(err)
+			}
+			if image := foundMysql.Spec.Template.Spec.Containers[0].Image; image != tt.wantMySQLImage {
+				t.Errorf("MySQL image = %q, want %q", image, tt.wantMySQLImage)
+			}
+			// MySQL 8.0 removed --ignore-db-dir and refuses to start with it
+			for _, arg := range foundMysql.Spec.Template.Spec.Containers[0].Args {
+				if strings.HasPrefix(arg, "--ignore-db-dir") {
+					t.Errorf("MySQL args = %v, %s is rejected by %s", foundMysql.Spec.Template.Spec.Containers[0].Args, arg, upgradeTestToImage)
+				}
+			}
+			if replicas := *foundMysql.Spec.Replicas; replicas != tt.wantMySQLReplicas {
+				t.Errorf("MySQL replicas = %d, want %d", replicas, tt.wantMySQLReplicas)
+			}
+			foundApp := &appsv1.Deployment{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(appDep), foundApp); err != nil {
+				t.Fatal(err)
+			}
+			if replicas := *foundApp.Spec.Replicas; replicas != tt.wantAppReplicas {
+				t.Errorf("recipe app replicas = %d, want %d", replicas, tt.wantAppReplicas)
+			}
+
+			if tt.wantJob != "" {
+				job := &batchv1.Job{}
+				if err := r.Get(ctx, client.ObjectKey{Name: "recipe" + tt.wantJob, Namespace: "default"}, job); err != nil {
+					t.Errorf("Job recipe%s was not created: %v", tt.wantJob, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// ingressGVK is the kind publishing the recipe app when the cluster neither serves Routes nor HTTPRoutes
+var ingressGVK = networkingv1.SchemeGroupVersion.WithKind("Ingress")
+
+// reconcileExpose publishes the recipe app with the kind picked by
+// exposeGVK, removes the objects of the other kinds, e.g. once spec.expose is
+// removed, and records the URL of the recipe app.
+func (r *RecipeReconciler) reconcileExpose(ctx context.Context, recipe *devconfczv1alpha1.Recipe) error {
+	desiredGVK := schema.GroupVersionKind{}
+	if recipe.Spec.Expose != nil {
+		gvk, err := r.exposeGVK(recipe)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Failed to discover the APIs publishing the recipe app")
+			return err
+		}
+		desiredGVK = gvk
+	}
+	for _, gvk := range []schema.GroupVersionKind{ingressGVK, resources.RouteGVK, resources.HTTPRouteGVK} {
+		if gvk == desiredGVK {
+			continue
+		}
+		if err := r.deleteExposed(ctx, recipe, gvk); err != nil {
+			return err
+		}
+	}
+
+	url := ""
+	var err error
+	switch desiredGVK {
+	case resources.RouteGVK:
+		url, err = r.reconcileRoute(ctx, recipe)
+	case resources.HTTPRouteGVK:
+		url, err = r.reconcileHTTPRoute(ctx, recipe)
+	case ingressGVK:
+		url, err = r.reconcileIngress(ctx, recipe)
+	}
+	if err != nil {
+		return err
+	}
+	return r.setRecipeURL(ctx, recipe, url)
+}
+
+// exposeGVK picks the kind publishing the recipe app among the APIs served by
+// the cluster: an HTTPRoute when a Gateway is set, then a Route on OpenShift,
+// then an Ingress
+func (r *RecipeReconciler) exposeGVK(recipe *devconfczv1alpha1.Recipe) (schema.GroupVersionKind, error) {
+	if recipe.Spec.Expose.Gateway != nil {
+		served, err := r.served(resources.HTTPRouteGVK)
+		if err != nil || served {
+			return resources.HTTPRouteGVK, err
+		}
+	}
+	served, err := r.served(resources.RouteGVK)
+	if err != nil || served {
+		return resources.RouteGVK, err
+	}
+	return ingressGVK, nil
+}
+
+// served reports whether the cluster serves the kind, as found by the
+// discovery backing the RESTMapper of the client
+func (r *RecipeReconciler) served(gvk schema.GroupVersionKind) (bool, error) {
+	_, err := r.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// deleteExposed deletes the object of the kind publishing the recipe app, when the recipe owns it
+func (r *RecipeReconciler) deleteExposed(ctx context.Context, recipe *devconfczv1alpha1.Recipe, gvk schema.GroupVersionKind) error {
+	log := log.FromContext(ctx)
+
+	served, err := r.served(gvk)
+	if err != nil || !served {
+		return err
+	}
+	found := &unstructured.Unstructured{}
+	found.SetGroupVersionKind(gvk)
+	err = r.Get(ctx, client.ObjectKey{Name: recipe.Name, Namespace: recipe.Namespace}, found)
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		log.Error(err, "Failed to get "+gvk.Kind, gvk.Kind+".Namespace", recipe.Namespace, gvk.Kind+".Name", recipe.Name)
+		return err
+	}
+	if !metav1.IsControlledBy(found, recipe) {
+		return nil
+	}
+	log.Info("Deleting "+gvk.Kind+" no longer publishing the recipe app", gvk.Kind+".Namespace", found.GetNamespace(), gvk.Kind+".Name", found.GetName())
+	if err := r.Delete(ctx, found); err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to delete "+gvk.Kind, gvk.Kind+".Namespace", found.GetNamespace(), gvk.Kind+".Name", found.GetName())
+		return err
+	}
+	return nil
+}
+
+// reconcileIngress creates or updates the Ingress of the recipe app and returns its URL
+func (r *RecipeReconciler) reconcileIngress(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (string, error) {
+	log := log.FromContext(ctx)
+
+	ingress, err := resources.IngressForRecipe(recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define new Ingress resource for recipe")
+		return "", err
+	}
+	found := &networkingv1.Ingress{}
+	err = r.Get(ctx, client.ObjectKey{Name: ingress.Name, Namespace: ingress.Namespace}, found)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+		if err := r.Create(ctx, ingress); err != nil {
+			log.Error(err, "Failed to create new Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+			return "", err
+		}
+		found = ingress
+	} else if err != nil {
+		log.Error(err, "Failed to get Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+		return "", err
+	} else if annotations, annotationsChanged := managedAnnotations(found, ingress); annotationsChanged ||
+		!equality.Semantic.DeepDerivative(ingress.Spec, found.Spec) ||
+		len(ingress.Spec.TLS) != len(found.Spec.TLS) {
+		log.Info("Updating Ingress", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+		found.Spec = ingress.Spec
+		found.Annotations = annotations
+		if err := r.Update(ctx, found); err != nil {
+			log.Error(err, "Failed to update Ingress", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+			return "", err
+		}
+	}
+
+	host := recipe.Spec.Expose.Host
+	if host == "" {
+		// The recipe app answers on any hostname of the load balancer
+		for _, lb := range found.Status.LoadBalancer.Ingress {
+			if lb.Hostname != "" {
+				host = lb.Hostname
+			} else {
+				host = lb.IP
+			}
+			break
+		}
+	}
+	return recipeURL(recipe, host), nil
+}
+
+// reconcileRoute creates or updates the OpenShift Route of the recipe app and returns its URL
+func (r *RecipeReconciler) reconcileRoute(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (string, error) {
+	log := log.FromContext(ctx)
+
+	var tlsSecret *corev1.Secret
+	if recipe.Spec.Expose.TLS != nil {
+		if name := resources.TLSSecretName(recipe); name != "" {
+			tlsSecret = &corev1.Secret{}
+			err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: recipe.Namespace}, tlsSecret)
+			if err != nil {
+				log.Error(err, "Failed to get TLS Secret", "Secret.Namespace", recipe.Namespace, "Secret.Name", name)
+				return "", err
+			}
+		}
+	}
+	route, err := resources.RouteForRecipe(recipe, tlsSecret, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define new Route resource for recipe")
+		return "", err
+	}
+	found, err := r.applyExposed(ctx, route, "tls", "path")
+	if err != nil {
+		return "", err
+	}
+	host, _, _ := unstructured.NestedString(found.Object, "spec", "host")
+	return recipeURL(recipe, host), nil
+}
+
+// reconcileHTTPRoute creates or updates the HTTPRoute of the recipe app and returns its URL
+func (r *RecipeReconciler) reconcileHTTPRoute(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (string, error) {
+	httpRoute, err := resources.HTTPRouteForRecipe(recipe, r.Scheme)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to define new HTTPRoute resource for recipe")
+		return "", err
+	}
+	if _, err := r.applyExposed(ctx, httpRoute, "hostnames"); err != nil {
+		return "", err
+	}
+	// The hostnames of the Gateway listener are not known without a host
+	return recipeURL(recipe, recipe.Spec.Expose.Host), nil
+}
+
+// applyExposed creates or updates a Route or an HTTPRoute and returns the
+// object found in the cluster. The optional fields of the spec must be set or
+// unset on both the desired and the found objects for them to be equal.
+func (r *RecipeReconciler) applyExposed(ctx context.Context, desired *unstructured.Unstructured, optionalFields ...string) (*unstructured.Unstructured, error) {
+	log := log.FromContext(ctx)
+	kind := desired.GetKind()
+
+	found := &unstructured.Unstructured{}
+	found.SetGroupVersionKind(desired.GroupVersionKind())
+	err := r.Get(ctx, client.ObjectKey{Name: desired.GetName(), Namespace: desired.GetNamespace()}, found)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new "+kind, kind+".Namespace", desired.GetNamespace(), kind+".Name", desired.GetName())
+		if err := r.Create(ctx, desired); err != nil {
+			log.Error(err, "Failed to create new "+kind, kind+".Namespace", desired.GetNamespace(), kind+".Name", desired.GetName())
+			return nil, err
+		}
+		return desired, nil
+	} else if err != nil {
+		log.Error(err, "Failed to get "+kind, kind+".Namespace", desired.GetNamespace(), kind+".Name", desired.GetName())
+		return nil, err
+	}
+
+	desiredSpec, _, _ := unstructured.NestedMap(desired.Object, "spec")
+	foundSpec, _, _ := unstructured.NestedMap(found.Object, "spec")
+	// Keep the hostname generated for a Route without host
+	if _, ok := desiredSpec["host"]; !ok && foundSpec["host"] != nil {
+		desiredSpec["host"] = foundSpec["host"]
+	}
+	annotations, changed := managedAnnotations(found, desired)
+	changed = changed || !equality.Semantic.DeepDerivative(desiredSpec, foundSpec)
+	for _, field := range optionalFields {
+		_, inDesired := desiredSpec[field]
+		_, inFound := foundSpec[field]
+		changed = changed || inDesired != inFound
+	}
+	if !changed {
+		return found, nil
+	}
+	log.Info("Updating "+kind, kind+".Namespace", found.GetNamespace(), kind+".Name", found.GetName())
+	found.Object["spec"] = desiredSpec
+	found.SetAnnotations(annotations)
+	if err := r.Update(ctx, found); err != nil {
+		log.Error(err, "Failed to update "+kind, kind+".Namespace", found.GetNamespace(), kind+".Name", found.GetName())
+		return nil, err
+	}
+	return found, nil
+}
+
+// setRecipeURL updates status.url when it changed
+func (r *RecipeReconciler) setRecipeURL(ctx context.Context, recipe *devconfczv1alpha1.Recipe, url string) error {
+	if recipe.Status.URL == url {
+		return nil
+	}
+	recipe.Status.URL = url
+	if err := r.Status().Update(ctx, recipe); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update recipe status")
+		return err
+	}
+	return nil
+}
+
+// recipeURL returns the URL the recipe app is published on, empty when the host is not known yet
+func recipeURL(recipe *devconfczv1alpha1.Recipe, host string) string {
+	if host == "" {
+		return ""
+	}
+	scheme := "http"
+	if recipe.Spec.Expose.TLS != nil {
+		scheme = "https"
+	}
+	path := recipe.Spec.Expose.Path
+	if path == "/" {
+		path = ""
+	}
+	return scheme + "://" + host + path
+}
+
+// managedAnnotations returns the annotations of the found object updated
+// with those set from the spec on the desired one, and whether they changed
+func managedAnnotations(found, desired metav1.Object) (map[string]string, bool) {
+	annotations := resources.ManageAnnotations(found.GetAnnotations(), desired.GetAnnotations())
+	return annotations, !equality.Semantic.DeepEqual(found.GetAnnotations(), annotations)
+}
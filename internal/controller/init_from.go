@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// typeDatabaseInitializedRecipe represents whether the dump of spec.database.initFrom was loaded
+const typeDatabaseInitializedRecipe = "DatabaseInitialized"
+
+// initDatabase runs the Job loading the dump of spec.database.initFrom and
+// reports whether it completed. Changes of the Job trigger a new reconcile.
+// The dump is loaded once, the Job is not run again once it was deleted.
+func (r *RecipeReconciler) initDatabase(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (bool, error) {
+	log := log.FromContext(ctx)
+
+	if meta.IsStatusConditionTrue(recipe.Status.Conditions, typeDatabaseInitializedRecipe) {
+		return true, nil
+	}
+	job, err := resources.JobForDatabaseInit(recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define Database Init Job for recipe")
+		return false, err
+	}
+	foundJob := &batchv1.Job{}
+	err = r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, foundJob)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		err = r.Create(ctx, job)
+		if err != nil {
+			log.Error(err, "Failed to create new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return false, err
+		}
+		return false, r.setDatabaseInitializedCondition(ctx, recipe, metav1.ConditionFalse, "Initializing",
+			fmt.Sprintf("Job %s is loading the initial dump", job.Name))
+	} else if err != nil {
+		log.Error(err, "Failed to get Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return false, err
+	}
+
+	switch {
+	case jobConditionTrue(foundJob, batchv1.JobComplete):
+		return true, r.setDatabaseInitializedCondition(ctx, recipe, metav1.ConditionTrue, "Initialized",
+			"The initial dump was loaded")
+	case jobConditionTrue(foundJob, batchv1.JobFailed):
+		return false, r.setDatabaseInitializedCondition(ctx, recipe, metav1.ConditionFalse, "InitFailed",
+			fmt.Sprintf("Job %s failed to load the initial dump, delete it to retry", foundJob.Name))
+	}
+	return false, nil
+}
+
+// setDatabaseInitializedCondition updates the DatabaseInitialized condition when it changed
+func (r *RecipeReconciler) setDatabaseInitializedCondition(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status metav1.ConditionStatus, reason, message string) error {
+	current := meta.FindStatusCondition(recipe.Status.Conditions, typeDatabaseInitializedRecipe)
+	if current != nil && current.Status == status && current.Reason == reason && current.Message == message {
+		return nil
+	}
+	meta.SetStatusCondition(&recipe.Status.Conditions, metav1.Condition{
+		Type:               typeDatabaseInitializedRecipe,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: recipe.Generation,
+	})
+	if err := r.Status().Update(ctx, recipe); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update recipe status")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+func TestInitDatabase(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+
+		wantInitialized bool
+		wantJob         bool
+	}{
+		{
+			name:    "new recipe loads the dump",
+			wantJob: true,
+		},
+		{
+			name: "failed load is retried once its Job was deleted",
+			conditions: []metav1.Condition{
+				{Type: typeDatabaseInitializedRecipe, Status: metav1.ConditionFalse, Reason: "InitFailed"},
+			},
+			wantJob: true,
+		},
+		{
+			name: "loaded dump is not loaded again once its Job was deleted",
+			conditions: []metav1.Condition{
+				{Type: typeDatabaseInitializedRecipe, Status: metav1.ConditionTrue, Reason: "Initialized"},
+			},
+			wantInitialized: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			recipe := &devconfczv1alpha1.Recipe{
+				ObjectMeta: metav1.ObjectMeta{Name: "recipe", Namespace: "default"},
+				Spec: devconfczv1alpha1.RecipeSpec{
+					Database: devconfczv1alpha1.DatabaseSpec{
+						InitFrom: &devconfczv1alpha1.InitFromSpec{
+							ConfigMap: &devconfczv1alpha1.InitFromConfigMapSource{Name: "dump", Key: "recipes.sql"},
+						},
+					},
+				},
+				Status: devconfczv1alpha1.RecipeStatus{Conditions: tt.conditions},
+			}
+			scheme := newTestScheme(t)
+			r := newFakeRecipeReconciler(scheme, recipe)
+			if err := r.Get(ctx, client.ObjectKeyFromObject(recipe), recipe); err != nil {
+				t.Fatal(err)
+			}
+
+			initialized, err := r.initDatabase(ctx, recipe)
+			if err != nil {
+				t.Fatalf("initDatabase() error = %v", err)
+			}
+			if initialized != tt.wantInitialized {
+				t.Errorf("initDatabase() = %v, want %v", initialized, tt.wantInitialized)
+			}
+
+			job, err := resources.JobForDatabaseInit(recipe, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{})
+			if created := err == nil; created != tt.wantJob {
+				t.Errorf("Job %s created = %v, want %v", job.Name, created, tt.wantJob)
+			}
+			if err != nil && !apierrors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// reconcileMetadata propagates spec.commonLabels, spec.commonAnnotations and
+// spec.podAnnotations to the existing objects of the recipe and to their pod
+// templates, removing the keys no longer set. New objects get them from the
+// resources package.
+func (r *RecipeReconciler) reconcileMetadata(ctx context.Context, recipe *devconfczv1alpha1.Recipe) error {
+	log := log.FromContext(ctx)
+
+	lists := []client.ObjectList{
+		&appsv1.DeploymentList{},
+		&corev1.ConfigMapList{},
+		&corev1.SecretList{},
+		&corev1.ServiceList{},
+		&corev1.PersistentVolumeClaimList{},
+		&batchv1.JobList{},
+		&batchv1.CronJobList{},
+		&autoscalingv2.HorizontalPodAutoscalerList{},
+		&networkingv1.IngressList{},
+		&networkingv1.NetworkPolicyList{},
+		&policyv1.PodDisruptionBudgetList{},
+	}
+	// Only list the optional APIs served by the cluster
+	if served, err := r.served(snapshotv1.SchemeGroupVersion.WithKind("VolumeSnapshot")); err != nil {
+		return err
+	} else if served {
+		lists = append(lists, &snapshotv1.VolumeSnapshotList{})
+	}
+	for _, gvk := range []schema.GroupVersionKind{resources.RouteGVK, resources.HTTPRouteGVK} {
+		if served, err := r.served(gvk); err != nil {
+			return err
+		} else if served {
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			lists = append(lists, list)
+		}
+	}
+
+	for _, list := range lists {
+		if err := r.List(ctx, list, client.InNamespace(recipe.Namespace)); err != nil {
+			log.Error(err, "Failed to list objects to propagate the metadata of the recipe to")
+			return err
+		}
+		objects, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range objects {
+			object, ok := item.(client.Object)
+			if !ok || !metav1.IsControlledBy(object, recipe) {
+				continue
+			}
+			changed := resources.PropagateMetadata(recipe, object)
+			// The pod template of a Job is immutable
+			switch object := object.(type) {
+			case *appsv1.Deployment:
+				changed = resources.PropagatePodMetadata(recipe, &object.Spec.Template) || changed
+			case *batchv1.CronJob:
+				changed = resources.PropagateMetadata(recipe, &object.Spec.JobTemplate) || changed
+				changed = resources.PropagatePodMetadata(recipe, &object.Spec.JobTemplate.Spec.Template) || changed
+			}
+			if !changed {
+				continue
+			}
+			gvk, err := apiutil.GVKForObject(object, r.Scheme)
+			if err != nil {
+				return err
+			}
+			kind := gvk.Kind
+			log.Info("Updating labels and annotations", "Kind", kind, "Namespace", object.GetNamespace(), "Name", object.GetName())
+			if err := r.Update(ctx, object); err != nil {
+				log.Error(err, "Failed to update labels and annotations", "Kind", kind, "Namespace", object.GetNamespace(), "Name", object.GetName())
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// reconcileNetworkPolicies creates or updates the NetworkPolicies of MySQL
+// and of the recipe app with spec.networkPolicy.enabled, and deletes them
+// once it is disabled
+func (r *RecipeReconciler) reconcileNetworkPolicies(ctx context.Context, recipe *devconfczv1alpha1.Recipe) error {
+	log := log.FromContext(ctx)
+
+	if !resources.NetworkPolicyEnabled(recipe) {
+		for _, name := range []string{recipe.Name + "-mysql", recipe.Name} {
+			found := &networkingv1.NetworkPolicy{}
+			err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: recipe.Namespace}, found)
+			if err != nil && apierrors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				log.Error(err, "Failed to get NetworkPolicy", "NetworkPolicy.Namespace", recipe.Namespace, "NetworkPolicy.Name", name)
+				return err
+			}
+			if !metav1.IsControlledBy(found, recipe) {
+				continue
+			}
+			log.Info("Deleting NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+			if err := r.Delete(ctx, found); err != nil && !apierrors.IsNotFound(err) {
+				log.Error(err, "Failed to delete NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+				return err
+			}
+		}
+		return nil
+	}
+
+	mysqlPolicy, err := resources.MySQLNetworkPolicyForRecipe(recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define new NetworkPolicy resource for mysql database")
+		return err
+	}
+	appPolicy, err := resources.AppNetworkPolicyForRecipe(recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define new NetworkPolicy resource for recipe application")
+		return err
+	}
+	for _, networkPolicy := range []*networkingv1.NetworkPolicy{mysqlPolicy, appPolicy} {
+		found := &networkingv1.NetworkPolicy{}
+		err := r.Get(ctx, client.ObjectKey{Name: networkPolicy.Name, Namespace: networkPolicy.Namespace}, found)
+		if err != nil && apierrors.IsNotFound(err) {
+			log.Info("Creating a new NetworkPolicy", "NetworkPolicy.Namespace", networkPolicy.Namespace, "NetworkPolicy.Name", networkPolicy.Name)
+			if err := r.Create(ctx, networkPolicy); err != nil {
+				log.Error(err, "Failed to create new NetworkPolicy", "NetworkPolicy.Namespace", networkPolicy.Namespace, "NetworkPolicy.Name", networkPolicy.Name)
+				return err
+			}
+			continue
+		} else if err != nil {
+			log.Error(err, "Failed to get NetworkPolicy", "NetworkPolicy.Namespace", networkPolicy.Namespace, "NetworkPolicy.Name", networkPolicy.Name)
+			return err
+		}
+		if !equality.Semantic.DeepEqual(found.Spec, networkPolicy.Spec) {
+			log.Info("Updating NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+			found.Spec = networkPolicy.Spec
+			if err := r.Update(ctx, found); err != nil {
+				log.Error(err, "Failed to update NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+				return err
+			}
+		}
+	}
+	return nil
+}
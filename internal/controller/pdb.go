@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// reconcilePodDisruptionBudgets creates or updates the PodDisruptionBudgets
+// of MySQL and of the recipe app, following the replicas of the recipe app
+func (r *RecipeReconciler) reconcilePodDisruptionBudgets(ctx context.Context, recipe *devconfczv1alpha1.Recipe) error {
+	log := log.FromContext(ctx)
+
+	mysqlPdb, err := resources.MySQLPodDisruptionBudgetForRecipe(recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define new PodDisruptionBudget resource for mysql database")
+		return err
+	}
+	appPdb, err := resources.PodDisruptionBudgetForRecipe(recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define new PodDisruptionBudget resource for recipe application")
+		return err
+	}
+	for _, pdb := range []*policyv1.PodDisruptionBudget{mysqlPdb, appPdb} {
+		found := &policyv1.PodDisruptionBudget{}
+		err := r.Get(ctx, client.ObjectKey{Name: pdb.Name, Namespace: pdb.Namespace}, found)
+		if err != nil && apierrors.IsNotFound(err) {
+			log.Info("Creating a new PodDisruptionBudget", "PodDisruptionBudget.Namespace", pdb.Namespace, "PodDisruptionBudget.Name", pdb.Name)
+			if err := r.Create(ctx, pdb); err != nil {
+				log.Error(err, "Failed to create new PodDisruptionBudget", "PodDisruptionBudget.Namespace", pdb.Namespace, "PodDisruptionBudget.Name", pdb.Name)
+				return err
+			}
+			continue
+		} else if err != nil {
+			log.Error(err, "Failed to get PodDisruptionBudget", "PodDisruptionBudget.Namespace", pdb.Namespace, "PodDisruptionBudget.Name", pdb.Name)
+			return err
+		}
+		if !equality.Semantic.DeepEqual(found.Spec.MinAvailable, pdb.Spec.MinAvailable) ||
+			!equality.Semantic.DeepEqual(found.Spec.MaxUnavailable, pdb.Spec.MaxUnavailable) ||
+			!equality.Semantic.DeepEqual(found.Spec.Selector, pdb.Spec.Selector) {
+			log.Info("Updating PodDisruptionBudget", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+			found.Spec.MinAvailable = pdb.Spec.MinAvailable
+			found.Spec.MaxUnavailable = pdb.Spec.MaxUnavailable
+			found.Spec.Selector = pdb.Spec.Selector
+			if err := r.Update(ctx, found); err != nil {
+				log.Error(err, "Failed to update PodDisruptionBudget", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -23,7 +23,11 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -47,6 +51,11 @@ type RecipeReconciler struct {
 //+kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=*
 //+kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheuses;servicemonitors;prometheusrule,verbs=*
 //+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;networkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes;routes/custom-host,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=configmaps;endpoints;events;persistentvolumeclaims;pods;namespaces;secrets;serviceaccounts;services;services/finalizers,verbs=*
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -78,6 +87,11 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, err
 	}
 
+	// Propagate the labels and annotations of the recipe to the existing objects
+	if err := r.reconcileMetadata(ctx, recipe); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Define a new ConfigMap object for initdbconfigmap mysql database
 	mysqlInitDBConfigMap, err := resources.MySQLInitDBConfigMapForRecipe(recipe, r.Scheme)
 	if err != nil {
@@ -118,6 +132,40 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, err
 	}
 
+	// Issue the certificates of the recipe app and of MySQL before they are mounted
+	renewAfter, err := r.reconcileCertificates(ctx, recipe)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Define a new ConfigMap object for the my.cnf of the mysql database
+	mysqlServerConfigMap, err := resources.MySQLServerConfigMapForRecipe(recipe, r.Scheme)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Check if the ConfigMap already exists and holds the configuration of the spec
+	foundMysqlServerConfigMap := &corev1.ConfigMap{}
+	err = r.Get(ctx, client.ObjectKey{Name: mysqlServerConfigMap.Name, Namespace: mysqlServerConfigMap.Namespace}, foundMysqlServerConfigMap)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new MySQL server ConfigMap", "ConfigMap.Namespace", mysqlServerConfigMap.Namespace, "ConfigMap.Name", mysqlServerConfigMap.Name)
+		err = r.Create(ctx, mysqlServerConfigMap)
+		if err != nil {
+			log.Error(err, "Failed to create new MySQL server ConfigMap", "ConfigMap.Namespace", mysqlServerConfigMap.Namespace, "ConfigMap.Name", mysqlServerConfigMap.Name)
+			return ctrl.Result{}, err
+		}
+	} else if err != nil {
+		log.Error(err, "Failed to get MySQL server ConfigMap")
+		return ctrl.Result{}, err
+	} else if !equality.Semantic.DeepEqual(foundMysqlServerConfigMap.Data, mysqlServerConfigMap.Data) {
+		log.Info("Updating MySQL server ConfigMap", "ConfigMap.Namespace", mysqlServerConfigMap.Namespace, "ConfigMap.Name", mysqlServerConfigMap.Name)
+		foundMysqlServerConfigMap.Data = mysqlServerConfigMap.Data
+		err = r.Update(ctx, foundMysqlServerConfigMap)
+		if err != nil {
+			log.Error(err, "Failed to update MySQL server ConfigMap", "ConfigMap.Namespace", mysqlServerConfigMap.Namespace, "ConfigMap.Name", mysqlServerConfigMap.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Define a new Secret object for mysql database
 	mysqlSecret, err := resources.MySQLSecretForRecipe(recipe, r.Scheme)
 	if err != nil {
@@ -146,7 +194,8 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, err
 	}
 	// Check if the service already exists
-	err = r.Get(ctx, client.ObjectKey{Name: service.Name, Namespace: service.Namespace}, &corev1.Service{})
+	foundService := &corev1.Service{}
+	err = r.Get(ctx, client.ObjectKey{Name: service.Name, Namespace: service.Namespace}, foundService)
 	if err != nil && apierrors.IsNotFound(err) {
 		log.Info("Creating a new service for recipe application")
 		err = r.Create(ctx, service)
@@ -160,6 +209,26 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		log.Error(err, "Failed to get service")
 		return ctrl.Result{}, err
 	}
+	// Update the service with the type, port and annotations of spec.service
+	annotations, annotationsChanged := managedAnnotations(foundService, service)
+	if foundService.Spec.Type != service.Spec.Type ||
+		foundService.Spec.SessionAffinity != service.Spec.SessionAffinity ||
+		!equality.Semantic.DeepEqual(foundService.Spec.LoadBalancerSourceRanges, service.Spec.LoadBalancerSourceRanges) ||
+		servicePortsChanged(foundService.Spec.Ports, service.Spec.Ports) ||
+		annotationsChanged {
+		log.Info("Updating service for recipe application", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name)
+		foundService.Annotations = annotations
+		foundService.Spec.Type = service.Spec.Type
+		foundService.Spec.SessionAffinity = service.Spec.SessionAffinity
+		// The API server defaults the timeout of ClientIP affinity and rejects it with None
+		foundService.Spec.SessionAffinityConfig = nil
+		foundService.Spec.LoadBalancerSourceRanges = service.Spec.LoadBalancerSourceRanges
+		foundService.Spec.Ports = updatedServicePorts(foundService.Spec.Ports, service.Spec.Ports)
+		if err := r.Update(ctx, foundService); err != nil {
+			log.Error(err, "Failed to update service for recipe application", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name)
+			return ctrl.Result{}, err
+		}
+	}
 
 	// Define a new service object for mysql database
 	service, err = resources.MySQLServiceForRecipe(recipe, r.Scheme)
@@ -168,7 +237,8 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, err
 	}
 	// Check if the service already exists
-	err = r.Get(ctx, client.ObjectKey{Name: service.Name, Namespace: service.Namespace}, &corev1.Service{})
+	foundService = &corev1.Service{}
+	err = r.Get(ctx, client.ObjectKey{Name: service.Name, Namespace: service.Namespace}, foundService)
 	if err != nil && apierrors.IsNotFound(err) {
 		log.Info("Creating a new service resource for mysql database")
 		err = r.Create(ctx, service)
@@ -182,6 +252,30 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		log.Error(err, "Failed to get service for mysql database")
 		return ctrl.Result{}, err
 	}
+	// Update the ports of a service created before they were named
+	if servicePortsChanged(foundService.Spec.Ports, service.Spec.Ports) {
+		log.Info("Updating service for mysql database", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name)
+		foundService.Spec.Ports = updatedServicePorts(foundService.Spec.Ports, service.Spec.Ports)
+		if err := r.Update(ctx, foundService); err != nil {
+			log.Error(err, "Failed to update service for mysql database", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Publish the recipe app with spec.expose
+	if err := r.reconcileExpose(ctx, recipe); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Restrict the traffic to MySQL and to the recipe app with spec.networkPolicy
+	if err := r.reconcileNetworkPolicies(ctx, recipe); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Limit the voluntary disruptions of MySQL and of the recipe app
+	if err := r.reconcilePodDisruptionBudgets(ctx, recipe); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	// Define a new persistent volume claim object
 	pvc, err := resources.PersistentVolumeClaimForRecipe(recipe, r.Scheme)
@@ -205,15 +299,44 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, err
 	}
 
+	// Create the backup volume before the initial restore mounts it, it is not
+	// needed when the backups are stored in S3
+	if recipe.Spec.Database.BackupPolicy.Destination.S3 == nil {
+		pvcCronJob, err := resources.PersistentVolumeClaimForBackup(recipe, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define PVC-CronJob for recipe")
+			return ctrl.Result{}, err
+		}
+		// Check if the pvcCronJob already exists
+		err = r.Get(ctx, client.ObjectKey{Name: pvcCronJob.Name, Namespace: pvcCronJob.Namespace}, &corev1.PersistentVolumeClaim{})
+		if err != nil && apierrors.IsNotFound(err) {
+			log.Info("Creating a new pvcCronJob")
+			err = r.Create(ctx, pvcCronJob)
+			if err != nil {
+				log.Error(err, "Failed to create new pvcCronJob", "pvcCronJob.Namespace", pvcCronJob.Namespace, "pvcCronJob.Name", pvcCronJob.Name)
+				return ctrl.Result{}, err
+			}
+			// pvcCronJob created successfully - return and requeue
+			return ctrl.Result{Requeue: true}, nil
+		} else if err != nil {
+			log.Error(err, "Failed to get pvcCronJob")
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Define a new mysql database Deployment object
 	dep, err := resources.MysqlDeploymentForRecipe(recipe, r.Scheme)
 	if err != nil {
 		log.Error(err, "Failed to define new mysql deployment resource for recipe")
 		return ctrl.Result{}, err
 	}
+	if err := r.withConfigChecksum(ctx, dep); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	// Check if the Mysql database Deployment already exists
-	err = r.Get(ctx, client.ObjectKey{Name: dep.Name, Namespace: dep.Namespace}, &appsv1.Deployment{})
+	foundMysqlDep := &appsv1.Deployment{}
+	err = r.Get(ctx, client.ObjectKey{Name: dep.Name, Namespace: dep.Namespace}, foundMysqlDep)
 	if err != nil && apierrors.IsNotFound(err) {
 		// Update status for MySQL Deployment
 		recipe.Status.MySQLStatus = "Creating..."
@@ -241,17 +364,85 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, err
 	}
 
+	// Orchestrate the change of the MySQL image before anything else is reconciled
+	upgraded, upgradeRetryAfter, err := r.upgradeDatabase(ctx, recipe, foundMysqlDep, dep.Spec.Template.Spec.Containers[0].Image)
+	if err != nil || !upgraded {
+		return ctrl.Result{RequeueAfter: upgradeRetryAfter}, err
+	}
+
+	// Restart MySQL with the new server arguments, init containers, configuration, resources, scheduling or probes, e.g. when binary logging is toggled,
+	// or when the ConfigMaps and Secrets of its environment were edited
+	foundMysql := &foundMysqlDep.Spec.Template.Spec
+	desiredMysql := &dep.Spec.Template.Spec
+	desiredHash := dep.Spec.Template.Annotations[resources.MySQLConfigHashAnnotation]
+	desiredChecksum := dep.Spec.Template.Annotations[resources.ConfigChecksumAnnotation]
+	// The image is only changed by upgradeDatabase, the init containers follow it
+	resources.SetMySQLImage(desiredMysql, foundMysql.Containers[0].Image)
+	if !equality.Semantic.DeepEqual(foundMysql.Containers[0].Args, desiredMysql.Containers[0].Args) ||
+		len(foundMysql.InitContainers) != len(desiredMysql.InitContainers) ||
+		!equality.Semantic.DeepDerivative(desiredMysql.InitContainers, foundMysql.InitContainers) ||
+		!equality.Semantic.DeepEqual(foundMysql.Containers[0].VolumeMounts, desiredMysql.Containers[0].VolumeMounts) ||
+		!equality.Semantic.DeepEqual(foundMysql.Containers[0].Resources, desiredMysql.Containers[0].Resources) ||
+		schedulingChanged(foundMysql, desiredMysql) ||
+		probesChanged(&foundMysql.Containers[0], &desiredMysql.Containers[0]) ||
+		!equality.Semantic.DeepEqual(volumeNames(foundMysql.Volumes), volumeNames(desiredMysql.Volumes)) ||
+		foundMysqlDep.Spec.Template.Annotations[resources.MySQLConfigHashAnnotation] != desiredHash ||
+		foundMysqlDep.Spec.Template.Annotations[resources.ConfigChecksumAnnotation] != desiredChecksum {
+		log.Info("Restarting mysql database deployment with the new configuration", "Deployment.Namespace", foundMysqlDep.Namespace, "Deployment.Name", foundMysqlDep.Name)
+		foundMysqlDep.Spec.Strategy = dep.Spec.Strategy
+		if foundMysqlDep.Spec.Template.Annotations == nil {
+			foundMysqlDep.Spec.Template.Annotations = map[string]string{}
+		}
+		foundMysqlDep.Spec.Template.Annotations[resources.MySQLConfigHashAnnotation] = desiredHash
+		foundMysqlDep.Spec.Template.Annotations[resources.ConfigChecksumAnnotation] = desiredChecksum
+		foundMysql.Containers[0].Args = desiredMysql.Containers[0].Args
+		foundMysql.InitContainers = desiredMysql.InitContainers
+		foundMysql.Containers[0].VolumeMounts = desiredMysql.Containers[0].VolumeMounts
+		foundMysql.Containers[0].Resources = desiredMysql.Containers[0].Resources
+		copyScheduling(foundMysql, desiredMysql)
+		copyProbes(&foundMysql.Containers[0], &desiredMysql.Containers[0])
+		foundMysql.Volumes = desiredMysql.Volumes
+		err = r.Update(ctx, foundMysqlDep)
+		if err != nil {
+			log.Error(err, "Failed to update mysql database deployment", "Deployment.Namespace", foundMysqlDep.Namespace, "Deployment.Name", foundMysqlDep.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Define a new recipe app deployment object
 	dep, err = resources.DeploymentForRecipe(recipe, r.Scheme)
 	if err != nil {
 		log.Error(err, "Failed to define new Deployment resource for recipe")
 		return ctrl.Result{}, err
 	}
+	if err := r.withConfigChecksum(ctx, dep); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	// Check if the Deployment already exists
 	found := &appsv1.Deployment{}
 	err = r.Get(ctx, client.ObjectKey{Name: dep.Name, Namespace: dep.Namespace}, found)
 	if err != nil && apierrors.IsNotFound(err) {
+		// Hold the recipe app until MySQL is available and the initial restore succeeded
+		ready, err := r.databaseReady(ctx, recipe, foundMysqlDep)
+		if err != nil || !ready {
+			return ctrl.Result{}, err
+		}
+		// Load the initial dump before the recipe app is deployed for the first time
+		if recipe.Spec.Database.InitFrom != nil {
+			initialized, err := r.initDatabase(ctx, recipe)
+			if err != nil || !initialized {
+				return ctrl.Result{}, err
+			}
+		}
+		// Copy the database of the source Recipe before the recipe app is deployed for the first time
+		if recipe.Spec.Source != nil {
+			cloned, retryAfter, err := r.cloneFromRecipe(ctx, recipe)
+			if err != nil || !cloned {
+				return ctrl.Result{RequeueAfter: retryAfter}, err
+			}
+		}
+
 		log.Info("Creating a new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
 		err = r.Create(ctx, dep)
 		if err != nil {
@@ -273,14 +464,24 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		log.Error(err, "Failed to get Deployment")
 		return ctrl.Result{}, err
 	} else if *found.Spec.Replicas != recipe.Spec.Replicas {
-		// Update the Recipe deployment if the number of replicas does not match the desired state
-		log.Info("Updating Recipe Deployment replicas", "Current", *found.Spec.Replicas, "Desired", recipe.Spec.Replicas)
-		found.Spec.Replicas = &recipe.Spec.Replicas
-		err = r.Update(ctx, found)
+		// A RecipeRestore keeps the app scaled down while it runs
+		restoring, err := r.restoreInProgress(ctx, recipe)
 		if err != nil {
-			log.Error(err, "Failed to update Recipe Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			log.Error(err, "Failed to list RecipeRestores")
 			return ctrl.Result{}, err
 		}
+		if restoring {
+			log.Info("Skip updating Recipe Deployment replicas: a restore is in progress", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+		} else {
+			// Update the Recipe deployment if the number of replicas does not match the desired state
+			log.Info("Updating Recipe Deployment replicas", "Current", *found.Spec.Replicas, "Desired", recipe.Spec.Replicas)
+			found.Spec.Replicas = &recipe.Spec.Replicas
+			err = r.Update(ctx, found)
+			if err != nil {
+				log.Error(err, "Failed to update Recipe Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+				return ctrl.Result{}, err
+			}
+		}
 	}
 
 	// If the Deployment already exists and the size is the same, then do nothing
@@ -312,6 +513,53 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	}
 
+	// Roll the recipe app out with the new scheduling constraints or probes
+	if schedulingChanged(&found.Spec.Template.Spec, &dep.Spec.Template.Spec) ||
+		probesChanged(&found.Spec.Template.Spec.Containers[0], &dep.Spec.Template.Spec.Containers[0]) {
+		log.Info("Updating Recipe App scheduling and probes", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+		copyScheduling(&found.Spec.Template.Spec, &dep.Spec.Template.Spec)
+		copyProbes(&found.Spec.Template.Spec.Containers[0], &dep.Spec.Template.Spec.Containers[0])
+		err = r.Update(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to update Recipe App scheduling and probes")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Roll the recipe app out when TLS to the database was enabled or disabled,
+	// or its pods are not allowed to reach MySQL yet
+	foundApp, desiredApp := &found.Spec.Template.Spec, &dep.Spec.Template.Spec
+	if found.Spec.Template.Labels[resources.DatabaseClientLabel] != recipe.Name ||
+		!equality.Semantic.DeepEqual(foundApp.Containers[0].Env, desiredApp.Containers[0].Env) ||
+		!equality.Semantic.DeepEqual(foundApp.Containers[0].VolumeMounts, desiredApp.Containers[0].VolumeMounts) ||
+		!equality.Semantic.DeepEqual(volumeNames(foundApp.Volumes), volumeNames(desiredApp.Volumes)) {
+		log.Info("Updating Recipe App database connection", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+		if found.Spec.Template.Labels == nil {
+			found.Spec.Template.Labels = map[string]string{}
+		}
+		found.Spec.Template.Labels[resources.DatabaseClientLabel] = recipe.Name
+		foundApp.Containers[0].Env = desiredApp.Containers[0].Env
+		foundApp.Containers[0].VolumeMounts = desiredApp.Containers[0].VolumeMounts
+		foundApp.Volumes = desiredApp.Volumes
+		err = r.Update(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to update Recipe App database connection")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Roll the recipe app out when the ConfigMaps or Secrets of its environment were edited
+	desiredChecksum = dep.Spec.Template.Annotations[resources.ConfigChecksumAnnotation]
+	if found.Spec.Template.Annotations[resources.ConfigChecksumAnnotation] != desiredChecksum {
+		log.Info("Updating Recipe App configuration checksum", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+		resources.WithConfigChecksum(&found.Spec.Template, desiredChecksum)
+		err = r.Update(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to update Recipe App configuration checksum")
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Update status for MySQL Deployment
 	recipe.Status.MySQLStatus = "Created"
 	// Update status for Recipe App Deployment
@@ -355,33 +603,38 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	}
 
-	pvcCronJob, err := resources.PersistentVolumeClaimForBackup(recipe, r.Scheme)
-	if err != nil {
-		log.Error(err, "Failed to define PVC-CronJob for recipe")
-		return ctrl.Result{}, err
+	// Each backup schedule runs its own CronJob, unless the backups are snapshots
+	cronJobs := []*batchv1.CronJob{}
+	if recipe.Spec.Database.BackupPolicy.Method != devconfczv1alpha1.BackupMethodSnapshot {
+		for _, schedule := range resources.BackupSchedulesForRecipe(recipe) {
+			cronJob, err := resources.CronJobForMySqlBackup(recipe, schedule, r.Scheme)
+			if err != nil {
+				log.Error(err, "Failed to create a CronJob Backup resource for recipe")
+				return ctrl.Result{}, err
+			}
+			cronJobs = append(cronJobs, cronJob)
+		}
 	}
-	// Check if the pvcCronJob already exists
-	err = r.Get(ctx, client.ObjectKey{Name: pvcCronJob.Name, Namespace: pvcCronJob.Namespace}, &corev1.PersistentVolumeClaim{})
-	if err != nil && apierrors.IsNotFound(err) {
-		log.Info("Creating a new pvcCronJob")
-		err = r.Create(ctx, pvcCronJob)
+	if recipe.Spec.Database.BackupPolicy.Verification != nil {
+		cronJob, err := resources.CronJobForBackupVerification(recipe, r.Scheme)
 		if err != nil {
-			log.Error(err, "Failed to create new pvcCronJob", "pvcCronJob.Namespace", pvcCronJob.Namespace, "pvcCronJob.Name", pvcCronJob.Name)
+			log.Error(err, "Failed to create a CronJob Backup Verification resource for recipe")
 			return ctrl.Result{}, err
 		}
-		// pvcCronJob created successfully - return and requeue
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get pvcCronJob")
-		return ctrl.Result{}, err
+		cronJobs = append(cronJobs, cronJob)
 	}
-
-	if recipe.Spec.Database.BackupPolicy.Schedule != "" {
-		cronJob, err := resources.CronJobForMySqlBackup(recipe, r.Scheme)
+	if recipe.Spec.Database.BackupPolicy.PointInTimeRecovery != nil {
+		cronJob, err := resources.CronJobForBinlogArchive(recipe, r.Scheme)
 		if err != nil {
-			log.Error(err, "Failed to create a CronJob Backup resource for recipe")
+			log.Error(err, "Failed to create a CronJob Binlog Archive resource for recipe")
 			return ctrl.Result{}, err
 		}
+		cronJobs = append(cronJobs, cronJob)
+	}
+
+	backupCronJobs := map[string]bool{}
+	for _, cronJob := range cronJobs {
+		backupCronJobs[cronJob.Name] = true
 
 		foundCronJob := &batchv1.CronJob{}
 		err = r.Get(ctx, client.ObjectKey{Name: cronJob.Name, Namespace: cronJob.Namespace}, foundCronJob)
@@ -397,34 +650,76 @@ func (r *RecipeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		} else if err != nil {
 			log.Error(err, "Failed to filter CronJob")
 			return ctrl.Result{}, err
+		} else if !equality.Semantic.DeepDerivative(cronJob.Spec, foundCronJob.Spec) {
+			// Update the CronJob if the schedule or the retention changed
+			log.Info("Updating CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+			foundCronJob.Labels = cronJob.Labels
+			foundCronJob.Spec = cronJob.Spec
+			err = r.Update(ctx, foundCronJob)
+			if err != nil {
+				log.Error(err, "Failed to update CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+				return ctrl.Result{}, err
+			}
 		}
 	}
 
-	if recipe.Spec.Database.InitRestore {
-		job, err := resources.JobForMySqlRestore(recipe, r.Scheme)
-		if err != nil {
-			log.Error(err, "Failed to define Restore Job for recipe")
-			return ctrl.Result{}, err
+	// Remove the CronJobs of schedules which are no longer defined
+	foundCronJobs := &batchv1.CronJobList{}
+	err = r.List(ctx, foundCronJobs, client.InNamespace(recipe.Namespace), client.MatchingLabels{"app": recipe.Name})
+	if err != nil {
+		log.Error(err, "Failed to list CronJobs")
+		return ctrl.Result{}, err
+	}
+	for i := range foundCronJobs.Items {
+		cronJob := &foundCronJobs.Items[i]
+		if backupCronJobs[cronJob.Name] || !metav1.IsControlledBy(cronJob, recipe) {
+			continue
 		}
-		// Check if the job already exists
-		foundJob := &batchv1.Job{}
-		err = r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, foundJob)
-		if err != nil && apierrors.IsNotFound(err) {
-			log.Info("Creating a new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
-			err = r.Create(ctx, job)
-			if err != nil {
-				log.Error(err, "Failed to create new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
-				return ctrl.Result{}, err
-			}
-			// Job created successfully - return and requeue
-			return ctrl.Result{Requeue: true}, nil
-		} else if err != nil {
-			log.Error(err, "Failed to filter Job")
+		log.Info("Deleting CronJob of removed backup schedule", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+		err = r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Error(err, "Failed to delete CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
 			return ctrl.Result{}, err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	// Take the VolumeSnapshots which are due when backing up with snapshots
+	snapshotAfter, err := r.reconcileSnapshots(ctx, recipe)
+	if err != nil {
+		log.Error(err, "Failed to reconcile recipe snapshots")
+		return ctrl.Result{}, err
+	}
+
+	// Record the backup history, health and verification outcome
+	backupCheckAfter, err := r.updateBackupStatus(ctx, recipe)
+	if err != nil {
+		log.Error(err, "Failed to update recipe backup status")
+		return ctrl.Result{}, err
+	}
+	if snapshotAfter != 0 && (backupCheckAfter == 0 || snapshotAfter < backupCheckAfter) {
+		backupCheckAfter = snapshotAfter
+	}
+	if renewAfter != 0 && (backupCheckAfter == 0 || renewAfter < backupCheckAfter) {
+		backupCheckAfter = renewAfter
+	}
+
+	// Check the backup health again even if no backup Job runs in the meantime,
+	// or renew the generated certificate when it is due first
+	return ctrl.Result{RequeueAfter: backupCheckAfter}, nil
+}
+
+// restoreInProgress reports whether a RecipeRestore for the recipe has not finished yet
+func (r *RecipeReconciler) restoreInProgress(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (bool, error) {
+	restores := &devconfczv1alpha1.RecipeRestoreList{}
+	if err := r.List(ctx, restores, client.InNamespace(recipe.Namespace)); err != nil {
+		return false, err
+	}
+	for i := range restores.Items {
+		if restores.Items[i].Spec.RecipeName == recipe.Name && !restoreFinished(&restores.Items[i]) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -436,8 +731,85 @@ func (r *RecipeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&corev1.Secret{}).
 		Owns(&corev1.Service{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
 		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
 		Owns(&batchv1.CronJob{}).
 		Owns(&batchv1.Job{}).
 		Complete(r)
 }
+
+// volumeNames lists the names of volumes, their sources being defaulted by the API server
+func volumeNames(volumes []corev1.Volume) []string {
+	names := make([]string, 0, len(volumes))
+	for _, volume := range volumes {
+		names = append(names, volume.Name)
+	}
+	return names
+}
+
+// schedulingChanged reports whether the scheduling constraints of the pods differ
+func schedulingChanged(found, desired *corev1.PodSpec) bool {
+	return !equality.Semantic.DeepEqual(found.NodeSelector, desired.NodeSelector) ||
+		!equality.Semantic.DeepEqual(found.Tolerations, desired.Tolerations) ||
+		!equality.Semantic.DeepEqual(found.Affinity, desired.Affinity) ||
+		!equality.Semantic.DeepEqual(found.TopologySpreadConstraints, desired.TopologySpreadConstraints) ||
+		found.PriorityClassName != desired.PriorityClassName ||
+		!equality.Semantic.DeepEqual(found.RuntimeClassName, desired.RuntimeClassName)
+}
+
+// copyScheduling sets the desired scheduling constraints on the pods
+func copyScheduling(found, desired *corev1.PodSpec) {
+	found.NodeSelector = desired.NodeSelector
+	found.Tolerations = desired.Tolerations
+	found.Affinity = desired.Affinity
+	found.TopologySpreadConstraints = desired.TopologySpreadConstraints
+	found.PriorityClassName = desired.PriorityClassName
+	found.RuntimeClassName = desired.RuntimeClassName
+}
+
+// probesChanged reports whether the probes of the container differ, ignoring
+// the fields left to the defaults of the API server
+func probesChanged(found, desired *corev1.Container) bool {
+	return !equality.Semantic.DeepDerivative(desired.StartupProbe, found.StartupProbe) ||
+		!equality.Semantic.DeepDerivative(desired.LivenessProbe, found.LivenessProbe) ||
+		!equality.Semantic.DeepDerivative(desired.ReadinessProbe, found.ReadinessProbe)
+}
+
+// copyProbes sets the desired probes on the container
+func copyProbes(found, desired *corev1.Container) {
+	found.StartupProbe = desired.StartupProbe
+	found.LivenessProbe = desired.LivenessProbe
+	found.ReadinessProbe = desired.ReadinessProbe
+}
+
+// servicePortsChanged reports whether the ports of the Service differ,
+// ignoring the node ports allocated by the API server
+func servicePortsChanged(found, desired []corev1.ServicePort) bool {
+	if len(found) != len(desired) {
+		return true
+	}
+	for i := range desired {
+		if found[i].Name != desired[i].Name ||
+			found[i].Protocol != desired[i].Protocol ||
+			found[i].Port != desired[i].Port ||
+			found[i].TargetPort != desired[i].TargetPort {
+			return true
+		}
+	}
+	return false
+}
+
+// updatedServicePorts returns the desired ports of the Service keeping the
+// allocated node ports, which the API server drops for ClusterIP Services
+func updatedServicePorts(found, desired []corev1.ServicePort) []corev1.ServicePort {
+	ports := make([]corev1.ServicePort, len(desired))
+	for i := range desired {
+		ports[i] = desired[i]
+		if i < len(found) {
+			ports[i].NodePort = found[i].NodePort
+		}
+	}
+	return ports
+}
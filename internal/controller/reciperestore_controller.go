@@ -0,0 +1,305 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// RecipeRestoreReconciler reconciles a RecipeRestore object
+type RecipeRestoreReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=devconfcz.opdev.com,resources=reciperestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=devconfcz.opdev.com,resources=reciperestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=devconfcz.opdev.com,resources=reciperestores/finalizers,verbs=update
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch
+
+// Reconcile drives a RecipeRestore through its phases: the recipe app is
+// scaled to zero, the restore Job is run against the MySQL database and the
+// app is scaled back to the replicas requested by the Recipe.
+func (r *RecipeRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	restore := &devconfczv1alpha1.RecipeRestore{}
+	err := r.Get(ctx, req.NamespacedName, restore)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("reciperestore resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get reciperestore")
+		return ctrl.Result{}, err
+	}
+
+	if restoreFinished(restore) {
+		return ctrl.Result{}, nil
+	}
+
+	recipe := &devconfczv1alpha1.Recipe{}
+	err = r.Get(ctx, client.ObjectKey{Name: restore.Spec.RecipeName, Namespace: restore.Namespace}, recipe)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, r.finish(ctx, restore, devconfczv1alpha1.RestorePhaseFailed,
+				fmt.Sprintf("Recipe %s not found", restore.Spec.RecipeName))
+		}
+		log.Error(err, "Failed to get recipe", "Recipe.Name", restore.Spec.RecipeName)
+		return ctrl.Result{}, err
+	}
+
+	if restore.Spec.TargetTime != nil && recipe.Spec.Database.BackupPolicy.PointInTimeRecovery == nil {
+		return ctrl.Result{}, r.finish(ctx, restore, devconfczv1alpha1.RestorePhaseFailed,
+			fmt.Sprintf("Recipe %s does not have pointInTimeRecovery enabled", recipe.Name))
+	}
+
+	if restore.Status.Phase == "" {
+		now := metav1.Now()
+		restore.Status.StartTime = &now
+		restore.Status.Phase = devconfczv1alpha1.RestorePhaseScalingDown
+		restore.Status.Message = "Scaling down the recipe app"
+		if err := r.Status().Update(ctx, restore); err != nil {
+			log.Error(err, "Failed to update reciperestore status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// Keep the recipe app at zero replicas until the restore Job has finished
+	dep := &appsv1.Deployment{}
+	err = r.Get(ctx, client.ObjectKey{Name: recipe.Name, Namespace: recipe.Namespace}, dep)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to get Recipe App Deployment")
+		return ctrl.Result{}, err
+	}
+	if err == nil && restore.Status.Phase == devconfczv1alpha1.RestorePhaseScalingDown {
+		if dep.Spec.Replicas == nil || *dep.Spec.Replicas != 0 {
+			log.Info("Scaling down Recipe App Deployment for restore", "Deployment.Name", dep.Name)
+			dep.Spec.Replicas = &[]int32{0}[0]
+			if err := r.Update(ctx, dep); err != nil {
+				log.Error(err, "Failed to scale down Recipe App Deployment", "Deployment.Name", dep.Name)
+				return ctrl.Result{}, err
+			}
+		}
+		if dep.Status.Replicas != 0 {
+			// Pods are still terminating - check again shortly
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+	}
+
+	if restore.Spec.SnapshotName != "" {
+		return r.restoreSnapshot(ctx, restore, recipe, dep)
+	}
+
+	// Define the restore job for the requested backup
+	job, err := resources.JobForRecipeRestore(restore, recipe, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define Restore Job for reciperestore")
+		return ctrl.Result{}, err
+	}
+	// Check if the job already exists
+	foundJob := &batchv1.Job{}
+	err = r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, foundJob)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new restore Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		err = r.Create(ctx, job)
+		if err != nil {
+			log.Error(err, "Failed to create new restore Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return ctrl.Result{}, err
+		}
+		restore.Status.Phase = devconfczv1alpha1.RestorePhaseRestoring
+		restore.Status.Message = fmt.Sprintf("Restore Job %s started", job.Name)
+		if err := r.Status().Update(ctx, restore); err != nil {
+			log.Error(err, "Failed to update reciperestore status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		log.Error(err, "Failed to get restore Job")
+		return ctrl.Result{}, err
+	}
+
+	phase, message := devconfczv1alpha1.RestorePhase(""), ""
+	if jobConditionTrue(foundJob, batchv1.JobComplete) {
+		phase, message = devconfczv1alpha1.RestorePhaseCompleted, "Backup restored successfully"
+	} else if jobConditionTrue(foundJob, batchv1.JobFailed) {
+		phase, message = devconfczv1alpha1.RestorePhaseFailed, fmt.Sprintf("Restore Job %s failed", foundJob.Name)
+	} else {
+		// The Job is still running, its status changes will trigger a new reconcile
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.scaleBack(ctx, recipe, dep); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.finish(ctx, restore, phase, message)
+}
+
+// restoreSnapshot restarts MySQL on a new PVC created from the requested
+// VolumeSnapshot and scales the recipe app back once MySQL is available.
+func (r *RecipeRestoreReconciler) restoreSnapshot(ctx context.Context, restore *devconfczv1alpha1.RecipeRestore, recipe *devconfczv1alpha1.Recipe, dep *appsv1.Deployment) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	snapshot := &snapshotv1.VolumeSnapshot{}
+	err := r.Get(ctx, client.ObjectKey{Name: restore.Spec.SnapshotName, Namespace: restore.Namespace}, snapshot)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, r.finish(ctx, restore, devconfczv1alpha1.RestorePhaseFailed,
+				fmt.Sprintf("VolumeSnapshot %s not found", restore.Spec.SnapshotName))
+		}
+		log.Error(err, "Failed to get VolumeSnapshot", "VolumeSnapshot.Name", restore.Spec.SnapshotName)
+		return ctrl.Result{}, err
+	}
+	if snapshot.Status != nil && snapshot.Status.Error != nil && snapshot.Status.Error.Message != nil {
+		return ctrl.Result{}, r.finish(ctx, restore, devconfczv1alpha1.RestorePhaseFailed,
+			fmt.Sprintf("VolumeSnapshot %s failed: %s", snapshot.Name, *snapshot.Status.Error.Message))
+	}
+	if snapshot.Status == nil || snapshot.Status.ReadyToUse == nil || !*snapshot.Status.ReadyToUse {
+		// The snapshot is not ready to be restored yet
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	// Create the PVC holding the restored MySQL data
+	pvc, err := resources.PersistentVolumeClaimFromSnapshot(restore, recipe, snapshot, r.Scheme)
+	if err != nil {
+		log.Error(err, "Failed to define PVC from VolumeSnapshot for reciperestore")
+		return ctrl.Result{}, err
+	}
+	err = r.Get(ctx, client.ObjectKey{Name: pvc.Name, Namespace: pvc.Namespace}, &corev1.PersistentVolumeClaim{})
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new PVC from VolumeSnapshot", "PVC.Namespace", pvc.Namespace, "PVC.Name", pvc.Name, "VolumeSnapshot.Name", snapshot.Name)
+		if err := r.Create(ctx, pvc); err != nil {
+			log.Error(err, "Failed to create new PVC", "PVC.Namespace", pvc.Namespace, "PVC.Name", pvc.Name)
+			return ctrl.Result{}, err
+		}
+		restore.Status.Phase = devconfczv1alpha1.RestorePhaseRestoring
+		restore.Status.Message = fmt.Sprintf("Restoring VolumeSnapshot %s to PVC %s", snapshot.Name, pvc.Name)
+		if err := r.Status().Update(ctx, restore); err != nil {
+			log.Error(err, "Failed to update reciperestore status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	} else if err != nil {
+		log.Error(err, "Failed to get PVC")
+		return ctrl.Result{}, err
+	}
+
+	// Keep MySQL on the restored PVC whenever its Deployment is defined again
+	if recipe.Status.DatabaseVolumeClaim != pvc.Name {
+		recipe.Status.DatabaseVolumeClaim = pvc.Name
+		if err := r.Status().Update(ctx, recipe); err != nil {
+			log.Error(err, "Failed to update recipe status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Restart MySQL on the restored PVC
+	mysqlDep := &appsv1.Deployment{}
+	err = r.Get(ctx, client.ObjectKey{Name: recipe.Name + "-mysql", Namespace: recipe.Namespace}, mysqlDep)
+	if err != nil {
+		log.Error(err, "Failed to get mysql database deployment")
+		return ctrl.Result{}, err
+	}
+	if resources.SetDatabaseClaim(&mysqlDep.Spec.Template.Spec, pvc.Name) {
+		log.Info("Switching mysql database deployment to the restored PVC", "Deployment.Name", mysqlDep.Name, "PVC.Name", pvc.Name)
+		if err := r.Update(ctx, mysqlDep); err != nil {
+			log.Error(err, "Failed to update mysql database deployment", "Deployment.Name", mysqlDep.Name)
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+	if mysqlDep.Status.ObservedGeneration < mysqlDep.Generation ||
+		mysqlDep.Status.UpdatedReplicas != mysqlDep.Status.Replicas ||
+		mysqlDep.Status.AvailableReplicas == 0 {
+		// MySQL is still starting on the restored PVC
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	if err := r.scaleBack(ctx, recipe, dep); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.finish(ctx, restore, devconfczv1alpha1.RestorePhaseCompleted,
+		fmt.Sprintf("VolumeSnapshot %s restored to PVC %s", snapshot.Name, pvc.Name))
+}
+
+// scaleBack scales the recipe app back to the replicas requested by the Recipe
+func (r *RecipeRestoreReconciler) scaleBack(ctx context.Context, recipe *devconfczv1alpha1.Recipe, dep *appsv1.Deployment) error {
+	if dep.Name == "" || (dep.Spec.Replicas != nil && *dep.Spec.Replicas == recipe.Spec.Replicas) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Scaling up Recipe App Deployment after restore", "Deployment.Name", dep.Name, "Replicas", recipe.Spec.Replicas)
+	dep.Spec.Replicas = &recipe.Spec.Replicas
+	if err := r.Update(ctx, dep); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to scale up Recipe App Deployment", "Deployment.Name", dep.Name)
+		return err
+	}
+	return nil
+}
+
+// finish records the terminal phase of a restore
+func (r *RecipeRestoreReconciler) finish(ctx context.Context, restore *devconfczv1alpha1.RecipeRestore, phase devconfczv1alpha1.RestorePhase, message string) error {
+	now := metav1.Now()
+	restore.Status.Phase = phase
+	restore.Status.Message = message
+	restore.Status.CompletionTime = &now
+	if err := r.Status().Update(ctx, restore); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update reciperestore status")
+		return err
+	}
+	return nil
+}
+
+// restoreFinished reports whether a restore reached a terminal phase
+func restoreFinished(restore *devconfczv1alpha1.RecipeRestore) bool {
+	return restore.Status.Phase == devconfczv1alpha1.RestorePhaseCompleted ||
+		restore.Status.Phase == devconfczv1alpha1.RestorePhaseFailed
+}
+
+// jobConditionTrue reports whether the Job has the given condition set to true
+func jobConditionTrue(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == conditionType && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RecipeRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&devconfczv1alpha1.RecipeRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
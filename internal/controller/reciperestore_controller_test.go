@@ -0,0 +1,256 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	//nolint:golint
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+var _ = Describe("RecipeRestore controller", func() {
+	Context("RecipeRestore controller test", func() {
+
+		const RecipeName = "test-recipe-restore"
+		const RestoreName = "test-restore"
+
+		ctx := context.Background()
+
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      RecipeName,
+				Namespace: RecipeName,
+			},
+		}
+
+		restoreNamespaceName := types.NamespacedName{
+			Name:      RestoreName,
+			Namespace: RecipeName,
+		}
+
+		BeforeEach(func() {
+			By("Creating the Namespace to perform the tests")
+			err := k8sClient.Create(ctx, namespace)
+			Expect(err).To(Not(HaveOccurred()))
+
+			By("creating the Recipe and its app Deployment")
+			recipe := &devconfczv1alpha1.Recipe{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RecipeName,
+					Namespace: namespace.Name,
+				},
+				Spec: devconfczv1alpha1.RecipeSpec{
+					Replicas: 2,
+					Version:  "v13",
+				},
+			}
+			Expect(k8sClient.Create(ctx, recipe)).To(Succeed())
+
+			dep, err := resources.DeploymentForRecipe(recipe, k8sClient.Scheme())
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(k8sClient.Create(ctx, dep)).To(Succeed())
+
+			By("creating the custom resource for the Kind RecipeRestore")
+			restore := &devconfczv1alpha1.RecipeRestore{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RestoreName,
+					Namespace: namespace.Name,
+				},
+				Spec: devconfczv1alpha1.RecipeRestoreSpec{
+					RecipeName: RecipeName,
+					BackupName: "202406150131.recipes.sql.gz",
+				},
+			}
+			Expect(k8sClient.Create(ctx, restore)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			By("removing the custom resources")
+			_ = k8sClient.Delete(ctx, &devconfczv1alpha1.RecipeRestore{ObjectMeta: metav1.ObjectMeta{Name: RestoreName, Namespace: RecipeName}})
+			_ = k8sClient.Delete(ctx, &devconfczv1alpha1.Recipe{ObjectMeta: metav1.ObjectMeta{Name: RecipeName, Namespace: RecipeName}})
+
+			By("Deleting the Namespace to perform the tests")
+			_ = k8sClient.Delete(ctx, namespace)
+		})
+
+		It("should scale down the recipe app and run the restore Job", func() {
+			restoreReconciler := &RecipeRestoreReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Reconciling the custom resource created")
+			for i := 0; i < 2; i++ {
+				_, err := restoreReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: restoreNamespaceName,
+				})
+				Expect(err).To(Not(HaveOccurred()))
+			}
+
+			By("Checking the recipe app was scaled down")
+			dep := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: RecipeName, Namespace: RecipeName}, dep)).To(Succeed())
+			Expect(*dep.Spec.Replicas).To(Equal(int32(0)))
+
+			By("Checking the restore Job was created for the requested backup")
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: RestoreName + "-restore", Namespace: RecipeName}, job)
+			}, time.Minute, time.Second).Should(Succeed())
+			Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+				Name:  "BACKUP_FILE",
+				Value: "202406150131.recipes.sql.gz",
+			}))
+
+			restore := &devconfczv1alpha1.RecipeRestore{}
+			Expect(k8sClient.Get(ctx, restoreNamespaceName, restore)).To(Succeed())
+			Expect(restore.Status.Phase).To(Equal(devconfczv1alpha1.RestorePhaseRestoring))
+		})
+	})
+
+	Context("RecipeRestore from a VolumeSnapshot", func() {
+
+		const RecipeName = "test-recipe-snapshot"
+		const RestoreName = "test-snapshot-restore"
+		const SnapshotName = "test-recipe-snapshot-20240615013100"
+
+		ctx := context.Background()
+
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      RecipeName,
+				Namespace: RecipeName,
+			},
+		}
+
+		restoreNamespaceName := types.NamespacedName{
+			Name:      RestoreName,
+			Namespace: RecipeName,
+		}
+
+		BeforeEach(func() {
+			By("Creating the Namespace to perform the tests")
+			err := k8sClient.Create(ctx, namespace)
+			Expect(err).To(Not(HaveOccurred()))
+
+			By("creating the Recipe with its app and MySQL Deployments")
+			recipe := &devconfczv1alpha1.Recipe{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RecipeName,
+					Namespace: namespace.Name,
+				},
+				Spec: devconfczv1alpha1.RecipeSpec{
+					Replicas: 1,
+					Version:  "v13",
+					Database: devconfczv1alpha1.DatabaseSpec{
+						BackupPolicy: devconfczv1alpha1.BackupPolicySpec{
+							Method: devconfczv1alpha1.BackupMethodSnapshot,
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, recipe)).To(Succeed())
+
+			dep, err := resources.DeploymentForRecipe(recipe, k8sClient.Scheme())
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(k8sClient.Create(ctx, dep)).To(Succeed())
+			mysqlDep, err := resources.MysqlDeploymentForRecipe(recipe, k8sClient.Scheme())
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(k8sClient.Create(ctx, mysqlDep)).To(Succeed())
+
+			By("creating a VolumeSnapshot of the MySQL volume which is ready to use")
+			snapshot, err := resources.VolumeSnapshotForRecipe(recipe, devconfczv1alpha1.BackupScheduleSpec{}, k8sClient.Scheme())
+			Expect(err).To(Not(HaveOccurred()))
+			snapshot.Name = SnapshotName
+			Expect(k8sClient.Create(ctx, snapshot)).To(Succeed())
+			ready := true
+			snapshot.Status = &snapshotv1.VolumeSnapshotStatus{ReadyToUse: &ready}
+			Expect(k8sClient.Status().Update(ctx, snapshot)).To(Succeed())
+
+			By("creating the custom resource for the Kind RecipeRestore")
+			restore := &devconfczv1alpha1.RecipeRestore{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RestoreName,
+					Namespace: namespace.Name,
+				},
+				Spec: devconfczv1alpha1.RecipeRestoreSpec{
+					RecipeName:   RecipeName,
+					SnapshotName: SnapshotName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, restore)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			By("removing the custom resources")
+			_ = k8sClient.Delete(ctx, &devconfczv1alpha1.RecipeRestore{ObjectMeta: metav1.ObjectMeta{Name: RestoreName, Namespace: RecipeName}})
+			_ = k8sClient.Delete(ctx, &devconfczv1alpha1.Recipe{ObjectMeta: metav1.ObjectMeta{Name: RecipeName, Namespace: RecipeName}})
+
+			By("Deleting the Namespace to perform the tests")
+			_ = k8sClient.Delete(ctx, namespace)
+		})
+
+		It("should restart MySQL on a PVC created from the snapshot", func() {
+			restoreReconciler := &RecipeRestoreReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Reconciling the custom resource created")
+			for i := 0; i < 3; i++ {
+				_, err := restoreReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: restoreNamespaceName,
+				})
+				Expect(err).To(Not(HaveOccurred()))
+			}
+
+			By("Checking the PVC was created from the snapshot")
+			pvc := &corev1.PersistentVolumeClaim{}
+			pvcName := RecipeName + "-mysql-" + RestoreName
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: RecipeName}, pvc)).To(Succeed())
+			Expect(pvc.Spec.DataSource).NotTo(BeNil())
+			Expect(pvc.Spec.DataSource.Kind).To(Equal("VolumeSnapshot"))
+			Expect(pvc.Spec.DataSource.Name).To(Equal(SnapshotName))
+
+			By("Checking MySQL was switched to the restored PVC")
+			recipe := &devconfczv1alpha1.Recipe{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: RecipeName, Namespace: RecipeName}, recipe)).To(Succeed())
+			Expect(recipe.Status.DatabaseVolumeClaim).To(Equal(pvcName))
+			mysqlDep := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: RecipeName + "-mysql", Namespace: RecipeName}, mysqlDep)).To(Succeed())
+			Expect(mysqlDep.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("VolumeSource.PersistentVolumeClaim.ClaimName", pvcName)))
+
+			restore := &devconfczv1alpha1.RecipeRestore{}
+			Expect(k8sClient.Get(ctx, restoreNamespaceName, restore)).To(Succeed())
+			Expect(restore.Status.Phase).To(Equal(devconfczv1alpha1.RestorePhaseRestoring))
+		})
+	})
+})
@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	resources "github.com/opdev/devconf-operator/internal/resources"
+)
+
+// snapshotAnnotation records on the snapshot lock Job the VolumeSnapshot taken while it holds the lock
+const snapshotAnnotation = "devconfcz.opdev.com/snapshot"
+
+// snapshotPollInterval is how often a snapshot in progress is checked
+const snapshotPollInterval = 2 * time.Second
+
+// reconcileSnapshots takes a VolumeSnapshot of the MySQL volume for the
+// backup schedules which are due and prunes the oldest snapshots beyond the
+// retention of each schedule. It returns when it should run again.
+func (r *RecipeReconciler) reconcileSnapshots(ctx context.Context, recipe *devconfczv1alpha1.Recipe) (time.Duration, error) {
+	if recipe.Spec.Database.BackupPolicy.Method != devconfczv1alpha1.BackupMethodSnapshot {
+		return 0, nil
+	}
+	log := log.FromContext(ctx)
+
+	snapshots := &snapshotv1.VolumeSnapshotList{}
+	err := r.List(ctx, snapshots, client.InNamespace(recipe.Namespace),
+		client.MatchingLabels{"app": recipe.Name}, client.HasLabels{resources.BackupScheduleLabel})
+	if err != nil {
+		log.Error(err, "Failed to list VolumeSnapshots")
+		return 0, err
+	}
+	lock := &batchv1.Job{}
+	err = r.Get(ctx, client.ObjectKey{Name: recipe.Name + "-snapshot-lock", Namespace: recipe.Namespace}, lock)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to get snapshot lock Job")
+		return 0, err
+	} else if err != nil {
+		lock = nil
+	}
+
+	// A snapshot in progress is finished before the next one is due
+	if lock != nil && !jobConditionTrue(lock, batchv1.JobFailed) {
+		return r.continueSnapshot(ctx, recipe, lock)
+	}
+
+	now := time.Now()
+	var requeueAfter time.Duration
+	for _, schedule := range resources.BackupSchedulesForRecipe(recipe) {
+		taken := snapshotsForSchedule(snapshots.Items, schedule.Name)
+		for i, snapshot := range taken {
+			if i < int(schedule.Retention) {
+				continue
+			}
+			if snapshot.Status == nil || (snapshot.Status.ReadyToUse == nil && snapshot.Status.Error == nil) {
+				// The snapshot is still being cut
+				continue
+			}
+			log.Info("Deleting VolumeSnapshot beyond retention", "VolumeSnapshot.Namespace", snapshot.Namespace, "VolumeSnapshot.Name", snapshot.Name)
+			if err := r.Delete(ctx, snapshot); err != nil && !apierrors.IsNotFound(err) {
+				log.Error(err, "Failed to delete VolumeSnapshot", "VolumeSnapshot.Namespace", snapshot.Namespace, "VolumeSnapshot.Name", snapshot.Name)
+				return 0, err
+			}
+		}
+
+		sched, err := cron.ParseStandard(cronSpecWithTimeZone(schedule.Schedule, recipe.Spec.Database.BackupPolicy.Tmz))
+		if err != nil {
+			log.Error(err, "Invalid backup schedule", "Schedule", schedule.Schedule)
+			continue
+		}
+		lastAttempt := recipe.CreationTimestamp.Time
+		if len(taken) > 0 {
+			lastAttempt = taken[0].CreationTimestamp.Time
+		}
+		if lock != nil && lock.Labels[resources.BackupScheduleLabel] == schedule.Name && lock.CreationTimestamp.After(lastAttempt) {
+			lastAttempt = lock.CreationTimestamp.Time
+		}
+		next := sched.Next(lastAttempt)
+		if next.After(now) {
+			if requeueAfter == 0 || next.Sub(now) < requeueAfter {
+				requeueAfter = next.Sub(now)
+			}
+			continue
+		}
+
+		// The schedule is due: replace the failed lock Job of a previous attempt
+		if lock != nil {
+			if lock.DeletionTimestamp == nil {
+				log.Info("Deleting failed snapshot lock Job", "Job.Namespace", lock.Namespace, "Job.Name", lock.Name)
+				if err := r.Delete(ctx, lock, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+					log.Error(err, "Failed to delete snapshot lock Job", "Job.Namespace", lock.Namespace, "Job.Name", lock.Name)
+					return 0, err
+				}
+			}
+			return snapshotPollInterval, nil
+		}
+		newLock, err := resources.JobForSnapshotLock(recipe, schedule, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define snapshot lock Job for recipe")
+			return 0, err
+		}
+		log.Info("Locking the tables for a snapshot", "Job.Namespace", newLock.Namespace, "Job.Name", newLock.Name)
+		if err := r.Create(ctx, newLock); err != nil {
+			log.Error(err, "Failed to create snapshot lock Job", "Job.Namespace", newLock.Namespace, "Job.Name", newLock.Name)
+			return 0, err
+		}
+		return snapshotPollInterval, nil
+	}
+
+	return requeueAfter, nil
+}
+
+// continueSnapshot takes the VolumeSnapshot once the lock Job holds the read
+// lock, and releases the lock by deleting the Job once the snapshot is cut.
+func (r *RecipeReconciler) continueSnapshot(ctx context.Context, recipe *devconfczv1alpha1.Recipe, lock *batchv1.Job) (time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	if lock.DeletionTimestamp != nil {
+		return snapshotPollInterval, nil
+	}
+	release := func() (time.Duration, error) {
+		log.Info("Releasing the snapshot lock", "Job.Namespace", lock.Namespace, "Job.Name", lock.Name)
+		err := r.Delete(ctx, lock, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Error(err, "Failed to delete snapshot lock Job", "Job.Namespace", lock.Namespace, "Job.Name", lock.Name)
+			return 0, err
+		}
+		return snapshotPollInterval, nil
+	}
+	if jobConditionTrue(lock, batchv1.JobComplete) {
+		// The lock timed out before the snapshot was taken
+		return release()
+	}
+
+	snapshotName := lock.Annotations[snapshotAnnotation]
+	if snapshotName == "" {
+		locked, err := r.jobPodReady(ctx, lock)
+		if err != nil {
+			return 0, err
+		}
+		if !locked {
+			return snapshotPollInterval, nil
+		}
+
+		schedule := devconfczv1alpha1.BackupScheduleSpec{Name: lock.Labels[resources.BackupScheduleLabel]}
+		snapshot, err := resources.VolumeSnapshotForRecipe(recipe, schedule, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to define VolumeSnapshot for recipe")
+			return 0, err
+		}
+		log.Info("Creating a new VolumeSnapshot", "VolumeSnapshot.Namespace", snapshot.Namespace, "VolumeSnapshot.Name", snapshot.Name)
+		if err := r.Create(ctx, snapshot); err != nil {
+			log.Error(err, "Failed to create new VolumeSnapshot", "VolumeSnapshot.Namespace", snapshot.Namespace, "VolumeSnapshot.Name", snapshot.Name)
+			return 0, err
+		}
+		if lock.Annotations == nil {
+			lock.Annotations = map[string]string{}
+		}
+		lock.Annotations[snapshotAnnotation] = snapshot.Name
+		if err := r.Update(ctx, lock); err != nil {
+			log.Error(err, "Failed to update snapshot lock Job", "Job.Namespace", lock.Namespace, "Job.Name", lock.Name)
+			return 0, err
+		}
+		return snapshotPollInterval, nil
+	}
+
+	// Keep the lock until the snapshot is cut, or gave up on
+	snapshot := &snapshotv1.VolumeSnapshot{}
+	err := r.Get(ctx, client.ObjectKey{Name: snapshotName, Namespace: lock.Namespace}, snapshot)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to get VolumeSnapshot", "VolumeSnapshot.Name", snapshotName)
+		return 0, err
+	}
+	if err == nil && snapshot.Status != nil && (snapshot.Status.CreationTime != nil || snapshot.Status.Error != nil) {
+		return release()
+	}
+	if err != nil || time.Since(lock.CreationTimestamp.Time) > resources.SnapshotLockTimeout {
+		log.Info("VolumeSnapshot was not cut in time", "VolumeSnapshot.Name", snapshotName)
+		return release()
+	}
+	return snapshotPollInterval, nil
+}
+
+// jobPodReady reports whether a pod of the Job is ready
+func (r *RecipeReconciler) jobPodReady(ctx context.Context, job *batchv1.Job) (bool, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// snapshotBackupStatus accounts the VolumeSnapshots which became ready or
+// failed since the last reconcile in the backup status, and returns since
+// when snapshots are expected.
+func (r *RecipeReconciler) snapshotBackupStatus(ctx context.Context, recipe *devconfczv1alpha1.Recipe, status *devconfczv1alpha1.BackupStatus) (metav1.Time, error) {
+	snapshots := &snapshotv1.VolumeSnapshotList{}
+	err := r.List(ctx, snapshots, client.InNamespace(recipe.Namespace),
+		client.MatchingLabels{"app": recipe.Name}, client.HasLabels{resources.BackupScheduleLabel})
+	if err != nil {
+		return metav1.Time{}, err
+	}
+
+	type snapshotEvent struct {
+		name       string
+		finishedAt metav1.Time
+		succeeded  bool
+	}
+	events := []snapshotEvent{}
+	for _, snapshot := range snapshots.Items {
+		created := snapshot.CreationTimestamp
+		if status.LastScheduleTime == nil || status.LastScheduleTime.Before(&created) {
+			status.LastScheduleTime = &created
+		}
+		switch {
+		case snapshot.Status == nil:
+		case snapshot.Status.Error != nil && snapshot.Status.Error.Time != nil:
+			events = append(events, snapshotEvent{snapshot.Name, *snapshot.Status.Error.Time, false})
+		case snapshot.Status.ReadyToUse != nil && *snapshot.Status.ReadyToUse && snapshot.Status.CreationTime != nil:
+			events = append(events, snapshotEvent{snapshot.Name, *snapshot.Status.CreationTime, true})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].finishedAt.Before(&events[j].finishedAt)
+	})
+
+	var seenUntil metav1.Time
+	if status.LastSuccessfulTime != nil {
+		seenUntil = *status.LastSuccessfulTime
+	}
+	if status.LastFailedTime != nil && seenUntil.Before(status.LastFailedTime) {
+		seenUntil = *status.LastFailedTime
+	}
+	for i := range events {
+		event := events[i]
+		if !seenUntil.Before(&event.finishedAt) {
+			continue
+		}
+		if event.succeeded {
+			status.LastSuccessfulTime = &event.finishedAt
+			status.LatestBackup = event.name
+			status.ConsecutiveFailures = 0
+		} else {
+			status.LastFailedTime = &event.finishedAt
+			status.ConsecutiveFailures++
+		}
+	}
+
+	return recipe.CreationTimestamp, nil
+}
+
+// snapshotsForSchedule returns the VolumeSnapshots of a backup schedule, most recent first
+func snapshotsForSchedule(snapshots []snapshotv1.VolumeSnapshot, schedule string) []*snapshotv1.VolumeSnapshot {
+	taken := []*snapshotv1.VolumeSnapshot{}
+	for i := range snapshots {
+		if snapshots[i].Labels[resources.BackupScheduleLabel] == schedule {
+			taken = append(taken, &snapshots[i])
+		}
+	}
+	sort.Slice(taken, func(i, j int) bool {
+		return taken[j].CreationTimestamp.Before(&taken[i].CreationTimestamp)
+	})
+	return taken
+}
+
+// cronSpecWithTimeZone evaluates a cron schedule in the given time zone, like the CronJob timeZone
+func cronSpecWithTimeZone(spec string, timeZone string) string {
+	if timeZone == "" {
+		return spec
+	}
+	return "CRON_TZ=" + timeZone + " " + spec
+}
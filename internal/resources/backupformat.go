@@ -0,0 +1,54 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// backupFormat sets BACKUP_EXT according to the compression and encryption
+// of the backups, and defines encode_backup, which turns a plain SQL dump
+// into a backup, and decode_backup, which prints any backup as plain SQL.
+const backupFormat = `BACKUP_EXT=".sql"
+[ "${BACKUP_COMPRESSION}" != "none" ] && BACKUP_EXT="${BACKUP_EXT}.gz"
+[ -n "${BACKUP_ENCRYPTION_KEY}" ] && BACKUP_EXT="${BACKUP_EXT}.enc"
+encode_backup() {
+  if [ "${BACKUP_COMPRESSION}" != "none" ]; then gzip; else cat; fi |
+  if [ -n "${BACKUP_ENCRYPTION_KEY}" ]; then openssl enc -aes-256-cbc -pbkdf2 -salt -pass env:BACKUP_ENCRYPTION_KEY; else cat; fi
+}
+decode_backup() {
+  case "$1" in
+    *.enc) openssl enc -d -aes-256-cbc -pbkdf2 -pass env:BACKUP_ENCRYPTION_KEY -in "$1" ;;
+    *) cat "$1" ;;
+  esac |
+  case "${1%.enc}" in
+    *.gz) gunzip -c ;;
+    *) cat ;;
+  esac
+}
+`
+
+// backupFormatEnvForRecipe returns the environment describing the compression
+// and encryption of the backups to the backup, restore and verification containers.
+func backupFormatEnvForRecipe(recipe *devconfczv1alpha1.Recipe) []corev1.EnvVar {
+	policy := recipe.Spec.Database.BackupPolicy
+	compression := policy.Compression
+	if compression == "" {
+		compression = "gzip"
+	}
+	env := []corev1.EnvVar{
+		{
+			Name:  "BACKUP_COMPRESSION",
+			Value: compression,
+		},
+	}
+	if policy.Encryption != nil {
+		keySecretRef := policy.Encryption.KeySecretRef
+		env = append(env, corev1.EnvVar{
+			Name: "BACKUP_ENCRYPTION_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &keySecretRef,
+			},
+		})
+	}
+	return env
+}
@@ -0,0 +1,166 @@
+package resources
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// CAValidity is the validity of the self-signed CA signing the generated certificates
+	CAValidity = 10 * 365 * 24 * time.Hour
+	// CARenewBefore is how long before its expiry the CA is renewed
+	CARenewBefore = 365 * 24 * time.Hour
+)
+
+// TLSSecretName returns the name of the Secret holding the certificate of spec.expose
+func TLSSecretName(recipe *devconfczv1alpha1.Recipe) string {
+	if recipe.Spec.Expose.TLS.SecretName != "" {
+		return recipe.Spec.Expose.TLS.SecretName
+	}
+	if recipe.Spec.Expose.TLS.Generate {
+		return recipe.Name + "-tls"
+	}
+	return ""
+}
+
+// CASecretName returns the name of the Secret holding the CA signing the generated certificate
+func CASecretName(recipe *devconfczv1alpha1.Recipe) string {
+	return recipe.Name + "-ca"
+}
+
+// CertificateDNSNames returns the names the generated certificate is valid
+// for: the host of spec.expose and the names of the recipe app Service
+func CertificateDNSNames(recipe *devconfczv1alpha1.Recipe) []string {
+	names := []string{}
+	if recipe.Spec.Expose.Host != "" {
+		names = append(names, recipe.Spec.Expose.Host)
+	}
+	return append(names,
+		recipe.Name,
+		recipe.Name+"."+recipe.Namespace,
+		recipe.Name+"."+recipe.Namespace+".svc",
+		recipe.Name+"."+recipe.Namespace+".svc.cluster.local",
+	)
+}
+
+// GenerateCA creates a self-signed CA and returns its PEM encoded certificate and key
+func GenerateCA(recipe *devconfczv1alpha1.Recipe, now time.Time) ([]byte, []byte, error) {
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   recipe.Name + "-ca",
+			Organization: []string{"devconf-operator"},
+		},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	return issueCertificate(template, nil, nil)
+}
+
+// IssueServingCertificate creates a serving certificate for the DNS names
+// signed by the CA and returns its PEM encoded certificate and key
+func IssueServingCertificate(names []string, caCertPEM, caKeyPEM []byte, validity time.Duration, now time.Time) ([]byte, []byte, error) {
+	ca, err := ParseCertificate(caCertPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(caKeyPEM)
+	if block == nil {
+		return nil, nil, errors.New("no PEM encoded key found")
+	}
+	caKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   names[0],
+			Organization: []string{"devconf-operator"},
+		},
+		DNSNames:    names,
+		NotBefore:   now.Add(-5 * time.Minute),
+		NotAfter:    now.Add(validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return issueCertificate(template, ca, caKey)
+}
+
+// issueCertificate signs the template with the CA, or self-signs it without
+// CA, using a new ECDSA P-256 key
+func issueCertificate(template, ca *x509.Certificate, caKey *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	if ca == nil {
+		ca, caKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// ParseCertificate parses the first PEM encoded certificate
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// SecretForCertificate creates a kubernetes.io/tls Secret holding a
+// generated certificate, its key and the CA certificate, and sets the owner reference
+func SecretForCertificate(recipe *devconfczv1alpha1.Recipe, name string, certPEM, keyPEM, caPEM []byte, scheme *runtime.Scheme) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+			"ca.crt":                caPEM,
+		},
+	}
+
+	withCommonMetadata(recipe, secret)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, secret, scheme); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,88 @@
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConfigChecksumAnnotation is set on the pod templates of the recipe app and
+// of MySQL with the checksum of the ConfigMaps and Secrets their environment
+// variables are read from, so that the pods restart when they are edited
+const ConfigChecksumAnnotation = "devconfcz.opdev.com/config-checksum"
+
+// EnvReferences returns the names of the ConfigMaps and of the Secrets the
+// environment variables of the containers of the pod are read from
+func EnvReferences(podSpec *corev1.PodSpec) ([]string, []string) {
+	configMaps, secrets := map[string]bool{}, map[string]bool{}
+	containers := append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMaps[env.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secrets[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				configMaps[envFrom.ConfigMapRef.Name] = true
+			}
+			if envFrom.SecretRef != nil {
+				secrets[envFrom.SecretRef.Name] = true
+			}
+		}
+	}
+	return sortedKeys(configMaps), sortedKeys(secrets)
+}
+
+// ConfigChecksum identifies the data of the ConfigMaps and of the Secrets
+func ConfigChecksum(configMaps []*corev1.ConfigMap, secrets []*corev1.Secret) string {
+	hash := sha256.New()
+	write := func(values ...string) {
+		for _, value := range values {
+			hash.Write([]byte(value))
+			hash.Write([]byte{0})
+		}
+	}
+	for _, configMap := range configMaps {
+		write("configmap", configMap.Name)
+		for _, key := range sortedKeys(configMap.Data) {
+			write(key, configMap.Data[key])
+		}
+		for _, key := range sortedKeys(configMap.BinaryData) {
+			write(key, string(configMap.BinaryData[key]))
+		}
+	}
+	for _, secret := range secrets {
+		write("secret", secret.Name)
+		for _, key := range sortedKeys(secret.Data) {
+			write(key, string(secret.Data[key]))
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// WithConfigChecksum sets the checksum of the configuration on the pod template
+func WithConfigChecksum(template *corev1.PodTemplateSpec, checksum string) {
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[ConfigChecksumAnnotation] = checksum
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
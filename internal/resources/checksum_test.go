@@ -0,0 +1,76 @@
+package resources
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfigChecksum(t *testing.T) {
+	configMap := func(name string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}, Data: data}
+	}
+	secret := func(name string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}, Data: map[string][]byte{}}
+		for key, value := range data {
+			s.Data[key] = []byte(value)
+		}
+		return s
+	}
+	base := ConfigChecksum(
+		[]*corev1.ConfigMap{configMap("recipe-mysql-config", map[string]string{"DB_HOST": "mysql", "DB_PORT": "3306"})},
+		[]*corev1.Secret{secret("recipe-mysql", map[string]string{"DB_PASSWORD": "secret"})},
+	)
+
+	tests := []struct {
+		name       string
+		configMaps []*corev1.ConfigMap
+		secrets    []*corev1.Secret
+		wantSame   bool
+	}{
+		{
+			name:       "same data",
+			configMaps: []*corev1.ConfigMap{configMap("recipe-mysql-config", map[string]string{"DB_PORT": "3306", "DB_HOST": "mysql"})},
+			secrets:    []*corev1.Secret{secret("recipe-mysql", map[string]string{"DB_PASSWORD": "secret"})},
+			wantSame:   true,
+		},
+		{
+			name:       "changed ConfigMap value",
+			configMaps: []*corev1.ConfigMap{configMap("recipe-mysql-config", map[string]string{"DB_HOST": "mysql", "DB_PORT": "3307"})},
+			secrets:    []*corev1.Secret{secret("recipe-mysql", map[string]string{"DB_PASSWORD": "secret"})},
+		},
+		{
+			name:       "changed Secret value",
+			configMaps: []*corev1.ConfigMap{configMap("recipe-mysql-config", map[string]string{"DB_HOST": "mysql", "DB_PORT": "3306"})},
+			secrets:    []*corev1.Secret{secret("recipe-mysql", map[string]string{"DB_PASSWORD": "rotated"})},
+		},
+		{
+			name:       "added key",
+			configMaps: []*corev1.ConfigMap{configMap("recipe-mysql-config", map[string]string{"DB_HOST": "mysql", "DB_PORT": "3306", "DB_SSL_MODE": "REQUIRED"})},
+			secrets:    []*corev1.Secret{secret("recipe-mysql", map[string]string{"DB_PASSWORD": "secret"})},
+		},
+		{
+			name:       "missing Secret",
+			configMaps: []*corev1.ConfigMap{configMap("recipe-mysql-config", map[string]string{"DB_HOST": "mysql", "DB_PORT": "3306"})},
+		},
+		{
+			name:       "same data in a Secret instead of a ConfigMap",
+			configMaps: []*corev1.ConfigMap{configMap("recipe-mysql", map[string]string{"DB_PASSWORD": "secret"})},
+			secrets:    []*corev1.Secret{secret("recipe-mysql-config", map[string]string{"DB_HOST": "mysql", "DB_PORT": "3306"})},
+		},
+		{
+			name:       "key and value boundary moved",
+			configMaps: []*corev1.ConfigMap{configMap("recipe-mysql-config", map[string]string{"DB_HOSTm": "ysql", "DB_PORT": "3306"})},
+			secrets:    []*corev1.Secret{secret("recipe-mysql", map[string]string{"DB_PASSWORD": "secret"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConfigChecksum(tt.configMaps, tt.secrets)
+			if same := got == base; same != tt.wantSame {
+				t.Errorf("ConfigChecksum() = %s, same as the base checksum %v, want %v", got, same, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package resources
+
+import (
+	"strings"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// cloneScript waits for MySQL to accept connections and streams a fresh
+// dump of the source database into it.
+const cloneScript = `set -eo pipefail
+MYSQL_AUTH=(-h "${MYSQL_HOST}" -u root -p"${MYSQL_ROOT_PASSWORD}" ${MYSQL_SSL_OPTS})
+for i in $(seq 60); do mysql "${MYSQL_AUTH[@]}" -e "SELECT 1" > /dev/null 2>&1 && break; sleep 5; done
+echo "=> Clone database ${SOURCE_DATABASE} from ${SOURCE_HOST} into ${MYSQL_DATABASE}"
+mysqldump --single-transaction --no-tablespaces -h "${SOURCE_HOST}" -P "${SOURCE_PORT}" -u "${SOURCE_USER}" -p"${SOURCE_PASSWORD}" "${SOURCE_DATABASE}" | mysql "${MYSQL_AUTH[@]}" "${MYSQL_DATABASE}"
+echo "=> Clone succeeded"
+`
+
+// SecretForClone creates a Secret holding the connection to the database of
+// the source Recipe, copied from its ConfigMap and Secret, so that the clone
+// Job can reach it from the namespace of the Recipe.
+func SecretForClone(recipe *devconfczv1alpha1.Recipe, source *devconfczv1alpha1.Recipe, sourceConfigMap *corev1.ConfigMap, sourceSecret *corev1.Secret, scheme *runtime.Scheme) (*corev1.Secret, error) {
+	host := sourceConfigMap.Data["DB_HOST"]
+	if !strings.Contains(host, ".") {
+		host += "." + source.Namespace + ".svc"
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-clone-source",
+			Namespace: recipe.Namespace,
+		},
+		Data: map[string][]byte{
+			"SOURCE_HOST":     []byte(host),
+			"SOURCE_PORT":     []byte(sourceConfigMap.Data["DB_PORT"]),
+			"SOURCE_DATABASE": []byte(sourceConfigMap.Data["MYSQL_DATABASE"]),
+			"SOURCE_USER":     []byte(sourceConfigMap.Data["MYSQL_USER"]),
+			"SOURCE_PASSWORD": sourceSecret.Data["MYSQL_PASSWORD"],
+		},
+	}
+
+	withCommonMetadata(recipe, secret)
+	if err := ctrl.SetControllerReference(recipe, secret, scheme); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// JobForClone creates a Job that copies the database of spec.source.fromRecipe into the MySQL Database
+func JobForClone(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-clone",
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:           "fradelg/mysql-cron-backup",
+						Name:            "mysql-clone",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources:       recipe.Spec.Database.JobResources,
+						Command:         []string{"/bin/bash", "-c", cloneScript},
+						EnvFrom: []corev1.EnvFromSource{
+							{
+								SecretRef: &corev1.SecretEnvSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: recipe.Name + "-clone-source",
+									},
+								},
+							},
+						},
+						Env: []corev1.EnvVar{
+							{
+								Name: "MYSQL_HOST",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "DB_HOST",
+									},
+								},
+							}, {
+								Name: "MYSQL_DATABASE",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "MYSQL_DATABASE",
+									},
+								},
+							}, {
+								Name: "MYSQL_ROOT_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql",
+										},
+										Key: "MYSQL_ROOT_PASSWORD",
+									},
+								},
+							},
+						},
+					}},
+					RestartPolicy: "OnFailure",
+				},
+			},
+		},
+	}
+
+	withJobDatabaseTLS(recipe, &job.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &job.Spec.Template)
+	// Allowed by the NetworkPolicy of the source Recipe to reach its MySQL
+	job.Spec.Template.Labels[CloneSourceLabel] = recipe.Spec.Source.FromRecipe.Name
+	withScheduling(&job.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withCommonMetadata(recipe, job, &job.Spec.Template)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
@@ -1,6 +1,13 @@
 package resources
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -8,6 +15,22 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// DatabaseName returns the name of the database of the recipe app
+func DatabaseName(recipe *devconfczv1alpha1.Recipe) string {
+	if recipe.Spec.Database.Name != "" {
+		return recipe.Spec.Database.Name
+	}
+	return "recipes"
+}
+
+// DatabaseUser returns the user of the recipe app in the database
+func DatabaseUser(recipe *devconfczv1alpha1.Recipe) string {
+	if recipe.Spec.Database.User != "" {
+		return recipe.Spec.Database.User
+	}
+	return "recipeuser"
+}
+
 // MySQLConfigMapForRecipe creates a ConfigMap for MySQL configuration
 func MySQLConfigMapForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*corev1.ConfigMap, error) {
 	configMap := &corev1.ConfigMap{
@@ -18,11 +41,12 @@ func MySQLConfigMapForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.S
 		Data: map[string]string{
 			"DB_HOST":        recipe.Name + "-mysql",
 			"DB_PORT":        "3306",
-			"MYSQL_DATABASE": "recipes",
-			"MYSQL_USER":     "recipeuser",
+			"MYSQL_DATABASE": DatabaseName(recipe),
+			"MYSQL_USER":     DatabaseUser(recipe),
 		},
 	}
 
+	withCommonMetadata(recipe, configMap)
 	if err := ctrl.SetControllerReference(recipe, configMap, scheme); err != nil {
 		return nil, err
 	}
@@ -38,16 +62,74 @@ func MySQLInitDBConfigMapForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *run
 			Namespace: recipe.Namespace,
 		},
 		Data: map[string]string{
-			"initdb.sql": `
-				CREATE USER IF NOT EXISTS 'recipeuser'@'%' IDENTIFIED BY 'recipepassword';
-				GRANT ALL PRIVILEGES ON recipes.* TO 'recipeuser'@'%';
-				FLUSH PRIVILEGES;`,
+			"initdb.sql": fmt.Sprintf(`
+				CREATE USER IF NOT EXISTS '%[2]s'@'%%' IDENTIFIED BY 'recipepassword';
+				GRANT ALL PRIVILEGES ON %[1]s.* TO '%[2]s'@'%%';
+				FLUSH PRIVILEGES;`, DatabaseName(recipe), DatabaseUser(recipe)),
+		},
+	}
+
+	withCommonMetadata(recipe, configMap)
+	if err := ctrl.SetControllerReference(recipe, configMap, scheme); err != nil {
+		return nil, err
+	}
+
+	return configMap, nil
+}
+
+// mysqlServerConfigForRecipe renders spec.database.config into a my.cnf, the
+// options are sorted so that the file only changes with the spec.
+func mysqlServerConfigForRecipe(recipe *devconfczv1alpha1.Recipe) string {
+	// spec.database.config may override the TLS options
+	options := mysqlTLSOptionsForRecipe(recipe)
+	if options == nil {
+		options = map[string]string{}
+	}
+	for key, value := range recipe.Spec.Database.Config {
+		options[key] = value
+	}
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var cnf strings.Builder
+	cnf.WriteString("[mysqld]\n")
+	for _, key := range keys {
+		fmt.Fprintf(&cnf, "%s = %s\n", key, options[key])
+	}
+	return cnf.String()
+}
+
+// MySQLServerConfigMapForRecipe creates a ConfigMap holding the my.cnf of the MySQL server
+func MySQLServerConfigMapForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-mysql-cnf",
+			Namespace: recipe.Namespace,
+		},
+		Data: map[string]string{
+			"recipe.cnf": mysqlServerConfigForRecipe(recipe),
 		},
 	}
 
+	withCommonMetadata(recipe, configMap)
 	if err := ctrl.SetControllerReference(recipe, configMap, scheme); err != nil {
 		return nil, err
 	}
 
 	return configMap, nil
 }
+
+// mysqlServerConfigHash identifies the my.cnf of the MySQL server and its
+// certificate, it is set on the pod template so that MySQL restarts when the
+// configuration changes or the certificate is renewed.
+func mysqlServerConfigHash(recipe *devconfczv1alpha1.Recipe) string {
+	config := mysqlServerConfigForRecipe(recipe)
+	if DatabaseTLSEnabled(recipe) && recipe.Status.DatabaseCertificate != nil && recipe.Status.DatabaseCertificate.NotAfter != nil {
+		config += "# certificate " + recipe.Status.DatabaseCertificate.NotAfter.UTC().Format(time.RFC3339) + "\n"
+	}
+	sum := sha256.Sum256([]byte(config))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,8 @@
 package resources
 
 import (
+	"strconv"
+
 	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -9,18 +11,86 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// defaultBackupRetention is the number of backups kept for the default schedule
+const defaultBackupRetention = 2
+
+// BackupScheduleLabel holds the backup schedule name on the backup CronJobs and their Jobs
+const BackupScheduleLabel = "backup-schedule"
+
+// backupScript dumps the database into the directory of its backup generation,
+// points the latest symlink at the new dump and prunes the oldest dumps of the
+// same generation beyond MAX_BACKUPS. With RECORD_SERVER_UUID, the dump starts
+// with the server UUID whose archived binary logs follow it.
+const backupScript = "set -eo pipefail\n" + backupFormat + `BACKUP_DIR="/backup${BACKUP_GENERATION:+/${BACKUP_GENERATION}}"
+mkdir -p "${BACKUP_DIR}"
+BACKUP_FILE="${BACKUP_DIR}/$(date +%Y%m%d%H%M).${MYSQL_DATABASE}${BACKUP_EXT}"
+echo "=> Backup database ${MYSQL_DATABASE} to ${BACKUP_FILE}"
+{
+  if [ -n "${RECORD_SERVER_UUID}" ]; then
+    echo "-- Server UUID: $(mysql ${MYSQL_SSL_OPTS} -h "${MYSQL_HOST}" -u "${MYSQL_USER}" -p"${MYSQL_PASSWORD}" -N -e "SELECT @@server_uuid")"
+  fi
+  mysqldump --single-transaction ${MYSQLDUMP_OPTS} ${MYSQL_SSL_OPTS} -h "${MYSQL_HOST}" -u "${MYSQL_USER}" -p"${MYSQL_PASSWORD}" "${MYSQL_DATABASE}"
+} | encode_backup > "${BACKUP_FILE}"
+rm -f /backup/latest.${MYSQL_DATABASE}.sql*
+ln -s "${BACKUP_FILE#/backup/}" "/backup/latest.${MYSQL_DATABASE}${BACKUP_EXT}"
+find "${BACKUP_DIR}" -maxdepth 1 -type f -name "*.${MYSQL_DATABASE}.sql*" | sort -r | tail -n +$((MAX_BACKUPS + 1)) | while read -r OLD_BACKUP; do
+  echo "==> Max number of (${MAX_BACKUPS}) backups reached. Deleting ${OLD_BACKUP}"
+  rm -f "${OLD_BACKUP}"
+done
+echo "${BACKUP_FILE#/backup/}" > /dev/termination-log
+echo "=> Backup succeeded"
+`
+
+// BackupSchedulesForRecipe returns every backup schedule of the recipe. The
+// unnamed default schedule comes from backupPolicySpec.schedule and keeps its
+// backups at the root of the backup volume.
+func BackupSchedulesForRecipe(recipe *devconfczv1alpha1.Recipe) []devconfczv1alpha1.BackupScheduleSpec {
+	policy := recipe.Spec.Database.BackupPolicy
+	schedules := []devconfczv1alpha1.BackupScheduleSpec{}
+	if policy.Schedule != "" {
+		retention := int32(defaultBackupRetention)
+		if policy.Retention != nil {
+			retention = *policy.Retention
+		}
+		schedules = append(schedules, devconfczv1alpha1.BackupScheduleSpec{
+			Schedule:  policy.Schedule,
+			Retention: retention,
+		})
+	}
+	return append(schedules, policy.Schedules...)
+}
+
 // CronJobForMySqlBackup creates a CronJob that backups the for MySQL Database
-func CronJobForMySqlBackup(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.CronJob, error) {
-	cronJob = &batchv1.CronJob{
+func CronJobForMySqlBackup(recipe *devconfczv1alpha1.Recipe, schedule devconfczv1alpha1.BackupScheduleSpec, scheme *runtime.Scheme) (*batchv1.CronJob, error) {
+	name := "mysql-job"
+	if schedule.Name != "" {
+		name = recipe.Name + "-backup-" + schedule.Name
+	}
+
+	var timeZone *string
+	if recipe.Spec.Database.BackupPolicy.Tmz != "" {
+		timeZone = &recipe.Spec.Database.BackupPolicy.Tmz
+	}
+
+	labels := map[string]string{
+		"app":               recipe.Name,
+		BackupScheduleLabel: schedule.Name,
+	}
+
+	cronJob := &batchv1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "mysql-job",
+			Name:      name,
 			Namespace: recipe.Namespace,
+			Labels:    labels,
 		},
 		Spec: batchv1.CronJobSpec{
 			ConcurrencyPolicy: batchv1.ForbidConcurrent,
-			Schedule:          recipe.Spec.Database.BackupPolicy.Schedule,
-			TimeZone:          &recipe.Spec.Database.BackupPolicy.Tmz,
+			Schedule:          schedule.Schedule,
+			TimeZone:          timeZone,
 			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
 				Spec: batchv1.JobSpec{
 					Template: corev1.PodTemplateSpec{
 						Spec: corev1.PodSpec{
@@ -28,14 +98,16 @@ func CronJobForMySqlBackup(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 								Image:           "fradelg/mysql-cron-backup",
 								Name:            "job-mysql",
 								ImagePullPolicy: corev1.PullIfNotPresent,
-								Env: []corev1.EnvVar{
+								Resources:       recipe.Spec.Database.JobResources,
+								Command:         []string{"/bin/bash", "-c", backupScript},
+								Env: append([]corev1.EnvVar{
 									{
 										Name:  "MAX_BACKUPS",
-										Value: "2",
+										Value: strconv.Itoa(int(schedule.Retention)),
 									},
 									{
-										Name:  "CRON_TIME",
-										Value: recipe.Spec.Database.BackupPolicy.Schedule,
+										Name:  "BACKUP_GENERATION",
+										Value: schedule.Name,
 									},
 									{
 										Name:  "MYSQLDUMP_OPTS",
@@ -51,6 +123,16 @@ func CronJobForMySqlBackup(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 												Key: "DB_HOST",
 											},
 										},
+									}, {
+										Name: "MYSQL_DATABASE",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: recipe.Name + "-mysql-config",
+												},
+												Key: "MYSQL_DATABASE",
+											},
+										},
 									}, {
 										Name: "MYSQL_USER",
 										ValueFrom: &corev1.EnvVarSource{
@@ -82,7 +164,7 @@ func CronJobForMySqlBackup(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 											},
 										},
 									},
-								},
+								}, backupFormatEnvForRecipe(recipe)...),
 								VolumeMounts: []corev1.VolumeMount{
 									{
 										Name:      recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
@@ -91,14 +173,7 @@ func CronJobForMySqlBackup(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 								},
 							}},
 							Volumes: []corev1.Volume{
-								{
-									Name: recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
-									VolumeSource: corev1.VolumeSource{
-										PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-											ClaimName: recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
-										},
-									},
-								},
+								backupVolumeForRecipe(recipe),
 							},
 							RestartPolicy: "OnFailure",
 						},
@@ -107,6 +182,14 @@ func CronJobForMySqlBackup(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 			},
 		},
 	}
+	withBinlogPosition(recipe, &cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0])
+	withJobDatabaseTLS(recipe, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &cronJob.Spec.JobTemplate.Spec.Template)
+	withScheduling(&cronJob.Spec.JobTemplate.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withS3Upload(recipe, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+
+	withCommonMetadata(recipe, cronJob, &cronJob.Spec.JobTemplate.Spec.Template)
+	PropagateMetadata(recipe, &cronJob.Spec.JobTemplate)
 	if err := ctrl.SetControllerReference(recipe, cronJob, scheme); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,127 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// mysqlTLSDir is where the MySQL server certificate is mounted in the MySQL pod
+	mysqlTLSDir = "/etc/mysql/tls"
+	// databaseCADir is where the CA of the MySQL server certificate is mounted in its clients
+	databaseCADir = "/etc/mysql-ca"
+)
+
+// DatabaseTLSEnabled reports whether the connections to MySQL use TLS
+func DatabaseTLSEnabled(recipe *devconfczv1alpha1.Recipe) bool {
+	return recipe.Spec.Database.TLS != nil && recipe.Spec.Database.TLS.Enabled
+}
+
+// MySQLTLSSecretName returns the name of the Secret holding the MySQL server certificate
+func MySQLTLSSecretName(recipe *devconfczv1alpha1.Recipe) string {
+	return recipe.Name + "-mysql-tls"
+}
+
+// MySQLCertificateDNSNames returns the names of the MySQL Service the server certificate is valid for
+func MySQLCertificateDNSNames(recipe *devconfczv1alpha1.Recipe) []string {
+	service := recipe.Name + "-mysql"
+	return []string{
+		service,
+		service + "." + recipe.Namespace,
+		service + "." + recipe.Namespace + ".svc",
+		service + "." + recipe.Namespace + ".svc.cluster.local",
+	}
+}
+
+// mysqlTLSOptionsForRecipe returns the options of the MySQL server enabling
+// TLS. Plain connections are rejected unless tls.allowInsecureTransport is
+// set, for the images of the recipe app which do not read DB_SSL_CA.
+func mysqlTLSOptionsForRecipe(recipe *devconfczv1alpha1.Recipe) map[string]string {
+	if !DatabaseTLSEnabled(recipe) {
+		return nil
+	}
+	requireSecureTransport := "ON"
+	if recipe.Spec.Database.TLS.AllowInsecureTransport {
+		requireSecureTransport = "OFF"
+	}
+	return map[string]string{
+		"ssl_ca":                   mysqlTLSDir + "/ca.crt",
+		"ssl_cert":                 mysqlTLSDir + "/" + corev1.TLSCertKey,
+		"ssl_key":                  mysqlTLSDir + "/" + corev1.TLSPrivateKeyKey,
+		"require_secure_transport": requireSecureTransport,
+	}
+}
+
+// withMySQLTLS mounts the server certificate into the MySQL pod
+func withMySQLTLS(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec) {
+	if !DatabaseTLSEnabled(recipe) {
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "mysql-tls",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: MySQLTLSSecretName(recipe),
+			},
+		},
+	})
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "mysql-tls",
+		MountPath: mysqlTLSDir,
+		ReadOnly:  true,
+	})
+}
+
+// withDatabaseCA mounts the CA of the MySQL server certificate into every
+// container of the pod and sets the environment variables returned by env
+func withDatabaseCA(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec, env []corev1.EnvVar) {
+	if !DatabaseTLSEnabled(recipe) {
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "mysql-ca",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: MySQLTLSSecretName(recipe),
+				Items: []corev1.KeyToPath{
+					{
+						Key:  "ca.crt",
+						Path: "ca.crt",
+					},
+				},
+			},
+		},
+	})
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      "mysql-ca",
+			MountPath: databaseCADir,
+			ReadOnly:  true,
+		})
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, env...)
+	}
+}
+
+// withAppDatabaseTLS makes the recipe app verify the MySQL server certificate
+func withAppDatabaseTLS(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec) {
+	withDatabaseCA(recipe, podSpec, []corev1.EnvVar{
+		{
+			Name:  "DB_SSL_CA",
+			Value: databaseCADir + "/ca.crt",
+		}, {
+			Name:  "DB_SSL_MODE",
+			Value: "VERIFY_IDENTITY",
+		},
+	})
+}
+
+// withJobDatabaseTLS sets the MYSQL_SSL_OPTS passed by the scripts of the
+// Jobs to the mysql clients, for them to verify the MySQL server certificate
+func withJobDatabaseTLS(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec) {
+	withDatabaseCA(recipe, podSpec, []corev1.EnvVar{
+		{
+			Name:  "MYSQL_SSL_OPTS",
+			Value: "--ssl-ca=" + databaseCADir + "/ca.crt",
+		},
+	})
+}
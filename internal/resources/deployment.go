@@ -134,6 +134,12 @@ func DeploymentForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Schem
 			},
 		},
 	}
+	withAppProbes(recipe, &dep.Spec.Template.Spec.Containers[0])
+	withAppDatabaseTLS(recipe, &dep.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &dep.Spec.Template)
+	withScheduling(&dep.Spec.Template.Spec, recipe.Spec.Scheduling)
+	dep.Spec.Template.Spec.Affinity = appAffinityForRecipe(recipe)
+	withCommonMetadata(recipe, dep, &dep.Spec.Template)
 	// Set the ownerRef for the Deployment
 	if err := ctrl.SetControllerReference(recipe, dep, scheme); err != nil {
 		return nil, err
@@ -0,0 +1,197 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// The Route and HTTPRoute kinds are built as unstructured objects, their
+// APIs are only served by the clusters which support them.
+var (
+	RouteGVK     = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+	HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+)
+
+// exposePath returns the path prefix the recipe app is published on
+func exposePath(recipe *devconfczv1alpha1.Recipe) string {
+	if recipe.Spec.Expose.Path == "" {
+		return "/"
+	}
+	return recipe.Spec.Expose.Path
+}
+
+// IngressForRecipe creates an Ingress publishing the recipe app Service and sets the owner reference
+func IngressForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*networkingv1.Ingress, error) {
+	expose := recipe.Spec.Expose
+	pathType := networkingv1.PathTypePrefix
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name,
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: expose.IngressClassName,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: expose.Host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     exposePath(recipe),
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: recipe.Name,
+											Port: networkingv1.ServiceBackendPort{
+												Number: ServicePort(recipe),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if expose.TLS != nil {
+		tls := networkingv1.IngressTLS{SecretName: TLSSecretName(recipe)}
+		if expose.Host != "" {
+			tls.Hosts = []string{expose.Host}
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{tls}
+	}
+
+	withManagedAnnotations(ingress, expose.Annotations)
+	withCommonMetadata(recipe, ingress)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, ingress, scheme); err != nil {
+		return nil, err
+	}
+
+	return ingress, nil
+}
+
+// RouteForRecipe creates an OpenShift Route publishing the recipe app Service
+// and sets the owner reference. The certificate and the key of tlsSecret, when
+// set, are copied into the Route, otherwise TLS uses the router certificate.
+func RouteForRecipe(recipe *devconfczv1alpha1.Recipe, tlsSecret *corev1.Secret, scheme *runtime.Scheme) (*unstructured.Unstructured, error) {
+	expose := recipe.Spec.Expose
+	spec := map[string]interface{}{
+		"to": map[string]interface{}{
+			"kind":   "Service",
+			"name":   recipe.Name,
+			"weight": int64(100),
+		},
+		"port": map[string]interface{}{
+			"targetPort": int64(5000),
+		},
+		"wildcardPolicy": "None",
+	}
+	if expose.Host != "" {
+		spec["host"] = expose.Host
+	}
+	if path := exposePath(recipe); path != "/" {
+		spec["path"] = path
+	}
+	if expose.TLS != nil {
+		tls := map[string]interface{}{
+			"termination":                   "edge",
+			"insecureEdgeTerminationPolicy": "Redirect",
+		}
+		if tlsSecret != nil {
+			tls["certificate"] = string(tlsSecret.Data[corev1.TLSCertKey])
+			tls["key"] = string(tlsSecret.Data[corev1.TLSPrivateKeyKey])
+			if ca, ok := tlsSecret.Data["ca.crt"]; ok {
+				tls["caCertificate"] = string(ca)
+			}
+		}
+		spec["tls"] = tls
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	route.SetGroupVersionKind(RouteGVK)
+	route.SetName(recipe.Name)
+	route.SetNamespace(recipe.Namespace)
+	withManagedAnnotations(route, expose.Annotations)
+	route.SetLabels(map[string]string{
+		"app": recipe.Name,
+	})
+
+	withCommonMetadata(recipe, route)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, route, scheme); err != nil {
+		return nil, err
+	}
+
+	return route, nil
+}
+
+// HTTPRouteForRecipe creates a Gateway API HTTPRoute attaching the recipe app
+// Service to the Gateway of spec.expose and sets the owner reference
+func HTTPRouteForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*unstructured.Unstructured, error) {
+	expose := recipe.Spec.Expose
+	parentRef := map[string]interface{}{
+		"group": HTTPRouteGVK.Group,
+		"kind":  "Gateway",
+		"name":  expose.Gateway.Name,
+	}
+	if expose.Gateway.Namespace != "" {
+		parentRef["namespace"] = expose.Gateway.Namespace
+	}
+	if expose.Gateway.SectionName != "" {
+		parentRef["sectionName"] = expose.Gateway.SectionName
+	}
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{
+							"type":  "PathPrefix",
+							"value": exposePath(recipe),
+						},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"name": recipe.Name,
+						"port": int64(ServicePort(recipe)),
+					},
+				},
+			},
+		},
+	}
+	if expose.Host != "" {
+		spec["hostnames"] = []interface{}{expose.Host}
+	}
+
+	httpRoute := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	httpRoute.SetGroupVersionKind(HTTPRouteGVK)
+	httpRoute.SetName(recipe.Name)
+	httpRoute.SetNamespace(recipe.Namespace)
+	withManagedAnnotations(httpRoute, expose.Annotations)
+	httpRoute.SetLabels(map[string]string{
+		"app": recipe.Name,
+	})
+
+	withCommonMetadata(recipe, httpRoute)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, httpRoute, scheme); err != nil {
+		return nil, err
+	}
+
+	return httpRoute, nil
+}
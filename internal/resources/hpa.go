@@ -31,7 +31,9 @@ func AutoScaler(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*auto
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      recipe.Name + "-hpa",
 			Namespace: recipe.Namespace,
-			Labels:    recipe.Labels,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
 		},
 		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
 			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
@@ -49,6 +51,7 @@ func AutoScaler(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*auto
 			Metrics: metrics,
 		},
 	}
+	withCommonMetadata(recipe, hpa)
 	// Set the ownerRef for the HorizontalPodAutoScaler
 	if err := ctrl.SetControllerReference(recipe, hpa, scheme); err != nil {
 		return nil, err
@@ -0,0 +1,166 @@
+package resources
+
+import (
+	"path"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// initFromScript waits for MySQL to accept connections and loads INIT_FILE into the database
+const initFromScript = "set -eo pipefail\n" + backupFormat + `MYSQL_AUTH=(-h "${MYSQL_HOST}" -u root -p"${MYSQL_ROOT_PASSWORD}" ${MYSQL_SSL_OPTS})
+for i in $(seq 60); do mysql "${MYSQL_AUTH[@]}" -e "SELECT 1" > /dev/null 2>&1 && break; sleep 5; done
+echo "=> Initialize database ${MYSQL_DATABASE} from ${INIT_FILE}"
+decode_backup "${INIT_FILE}" | mysql "${MYSQL_AUTH[@]}" "${MYSQL_DATABASE}"
+echo "=> Initialization succeeded"
+`
+
+// s3InitFromScript downloads the S3 object of the dump to INIT_FILE
+const s3InitFromScript = s3Setup + `echo "=> Download ${S3_ROOT}/${S3_KEY}"
+${MC} cp "${S3_ROOT}/${S3_KEY}" "${INIT_FILE}"
+`
+
+// JobForDatabaseInit creates a Job that loads the dump of spec.database.initFrom into the MySQL Database
+func JobForDatabaseInit(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	initFrom := recipe.Spec.Database.InitFrom
+
+	var initFile string
+	var volume corev1.Volume
+	switch {
+	case initFrom.PersistentVolumeClaim != nil:
+		initFile = path.Join("/init", initFrom.PersistentVolumeClaim.Path)
+		volume = corev1.Volume{
+			Name: "init",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: initFrom.PersistentVolumeClaim.ClaimName,
+					ReadOnly:  true,
+				},
+			},
+		}
+	case initFrom.ConfigMap != nil:
+		initFile = path.Join("/init", initFrom.ConfigMap.Key)
+		volume = corev1.Volume{
+			Name: "init",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: initFrom.ConfigMap.Name,
+					},
+				},
+			},
+		}
+	case initFrom.S3 != nil:
+		initFile = path.Join("/init", path.Base(initFrom.S3.Key))
+		volume = corev1.Volume{
+			Name: "init",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		}
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-init-from",
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:           "fradelg/mysql-cron-backup",
+						Name:            "mysql-init-from",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources:       recipe.Spec.Database.JobResources,
+						Command:         []string{"/bin/bash", "-c", initFromScript},
+						Env: []corev1.EnvVar{
+							{
+								Name:  "INIT_FILE",
+								Value: initFile,
+							},
+							{
+								Name: "MYSQL_HOST",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "DB_HOST",
+									},
+								},
+							}, {
+								Name: "MYSQL_DATABASE",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "MYSQL_DATABASE",
+									},
+								},
+							}, {
+								Name: "MYSQL_ROOT_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql",
+										},
+										Key: "MYSQL_ROOT_PASSWORD",
+									},
+								},
+							},
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "init",
+								MountPath: "/init",
+							},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						volume,
+					},
+					RestartPolicy: "OnFailure",
+				},
+			},
+		},
+	}
+	if initFrom.S3 != nil {
+		download := job.Spec.Template.Spec.Containers[0]
+		download.Env = append(download.Env, corev1.EnvVar{
+			Name:  "S3_KEY",
+			Value: initFrom.S3.Key,
+		})
+		job.Spec.Template.Spec.InitContainers = []corev1.Container{
+			s3Container(&initFrom.S3.S3DestinationSpec, "s3-download", s3InitFromScript, download),
+		}
+	}
+
+	if initFrom.Encryption != nil {
+		keySecretRef := initFrom.Encryption.KeySecretRef
+		job.Spec.Template.Spec.Containers[0].Env = append(job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{
+			Name: "BACKUP_ENCRYPTION_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &keySecretRef,
+			},
+		})
+	}
+
+	withJobDatabaseTLS(recipe, &job.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &job.Spec.Template)
+	withScheduling(&job.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withCommonMetadata(recipe, job, &job.Spec.Template)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
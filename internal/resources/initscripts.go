@@ -0,0 +1,59 @@
+package resources
+
+import (
+	"fmt"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// initScriptsForRecipe projects the generated initdb.sql and the scripts of
+// spec.database.initScripts into /docker-entrypoint-initdb.d. MySQL runs the
+// files in alphabetical order, so every file is prefixed with its position.
+func initScriptsForRecipe(recipe *devconfczv1alpha1.Recipe) []corev1.VolumeProjection {
+	sources := []corev1.VolumeProjection{
+		{
+			ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: recipe.Name + "-mysql-initdb-config",
+				},
+				Items: []corev1.KeyToPath{
+					{
+						Key:  "initdb.sql",
+						Path: "000-initdb.sql",
+					},
+				},
+			},
+		},
+	}
+
+	position := 0
+	for _, script := range recipe.Spec.Database.InitScripts {
+		items := make([]corev1.KeyToPath, 0, len(script.Keys))
+		for _, key := range script.Keys {
+			position++
+			items = append(items, corev1.KeyToPath{
+				Key:  key,
+				Path: fmt.Sprintf("%03d-%s", position, key),
+			})
+		}
+		switch {
+		case script.ConfigMap != nil:
+			sources = append(sources, corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: *script.ConfigMap,
+					Items:                items,
+				},
+			})
+		case script.Secret != nil:
+			sources = append(sources, corev1.VolumeProjection{
+				Secret: &corev1.SecretProjection{
+					LocalObjectReference: *script.Secret,
+					Items:                items,
+				},
+			})
+		}
+	}
+
+	return sources
+}
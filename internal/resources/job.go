@@ -9,11 +9,63 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-// JobForMySqlRestore creates a Job that restores the for MySQL Database
+// restoreScript loads BACKUP_FILE from the backup volume into the database,
+// falling back to the latest backup when BACKUP_FILE is empty, or to the
+// latest backup taken before the target time, whose binary logs are then
+// replayed up to it. With BACKUP_OPTIONAL, a missing backup is not an error.
+const restoreScript = "set -eo pipefail\n" + backupFormat + backupBefore + `if [ -z "${BACKUP_FILE}" ] && [ -n "${TARGET_STAMP}" ]; then
+  BACKUP_FILE="$(cd /backup && find . -maxdepth 2 -type f -name "[0-9]*.${MYSQL_DATABASE}.sql*" | backup_before "${TARGET_STAMP}" ./)"
+  if [ -z "${BACKUP_FILE}" ]; then
+    echo "No backup taken before ${TARGET_TIME}" | tee /dev/termination-log
+    exit 1
+  fi
+fi
+BACKUP_FILE="/backup/${BACKUP_FILE:-latest.${MYSQL_DATABASE}${BACKUP_EXT}}"
+if [ -n "${BACKUP_OPTIONAL}" ] && [ ! -e "${BACKUP_FILE}" ]; then
+  echo "=> No backup ${BACKUP_FILE} to restore yet"
+  exit 0
+fi
+echo "=> Restore database ${MYSQL_DATABASE} from ${BACKUP_FILE}"
+decode_backup "${BACKUP_FILE}" | mysql -h "${MYSQL_HOST}" -u root -p"${MYSQL_ROOT_PASSWORD}" ${MYSQL_SSL_OPTS} "${MYSQL_DATABASE}"
+` + binlogReplay + `echo "=> Restore succeeded"
+`
+
+// JobForMySqlRestore creates a Job that restores the latest backup, if any,
+// into the MySQL Database of a new Recipe
 func JobForMySqlRestore(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.Job, error) {
-	job = &batchv1.Job{
+	job := restoreJobForRecipe(recipe, recipe.Name+"-init-restore", "", nil)
+	// The first Recipe of a namespace has nothing to restore yet
+	for i := range job.Spec.Template.Spec.InitContainers {
+		job.Spec.Template.Spec.InitContainers[i].Env = append(job.Spec.Template.Spec.InitContainers[i].Env, backupOptionalEnv)
+	}
+	job.Spec.Template.Spec.Containers[0].Env = append(job.Spec.Template.Spec.Containers[0].Env, backupOptionalEnv)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// backupOptionalEnv lets the restore and S3 download scripts succeed without backup
+var backupOptionalEnv = corev1.EnvVar{
+	Name:  "BACKUP_OPTIONAL",
+	Value: "true",
+}
+
+// JobForRecipeRestore creates a Job that restores the backup requested by a RecipeRestore
+func JobForRecipeRestore(restore *devconfczv1alpha1.RecipeRestore, recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	job := restoreJobForRecipe(recipe, restore.Name+"-restore", restore.Spec.BackupName, restore.Spec.TargetTime)
+	if err := ctrl.SetControllerReference(restore, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func restoreJobForRecipe(recipe *devconfczv1alpha1.Recipe, name string, backupName string, targetTime *metav1.Time) *batchv1.Job {
+	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "mysql-restore-job",
+			Name:      name,
 			Namespace: recipe.Namespace,
 		},
 		Spec: batchv1.JobSpec{
@@ -23,14 +75,12 @@ func JobForMySqlRestore(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme
 						Image:           "fradelg/mysql-cron-backup",
 						Name:            "mysql-restore-job",
 						ImagePullPolicy: corev1.PullIfNotPresent,
-						Env: []corev1.EnvVar{
+						Resources:       recipe.Spec.Database.JobResources,
+						Command:         []string{"/bin/bash", "-c", restoreScript},
+						Env: append([]corev1.EnvVar{
 							{
-								Name:  "CRON_TIME",
-								Value: recipe.Spec.Database.BackupPolicy.Schedule,
-							},
-							{
-								Name:  "INIT_RESTORE_LATEST",
-								Value: "1",
+								Name:  "BACKUP_FILE",
+								Value: backupName,
 							},
 							{
 								Name: "MYSQL_HOST",
@@ -42,6 +92,16 @@ func JobForMySqlRestore(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme
 										Key: "DB_HOST",
 									},
 								},
+							}, {
+								Name: "MYSQL_DATABASE",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "MYSQL_DATABASE",
+									},
+								},
 							}, {
 								Name: "MYSQL_USER",
 								ValueFrom: &corev1.EnvVarSource{
@@ -73,7 +133,7 @@ func JobForMySqlRestore(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme
 									},
 								},
 							},
-						},
+						}, backupFormatEnvForRecipe(recipe)...),
 						VolumeMounts: []corev1.VolumeMount{
 							{
 								Name:      recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
@@ -82,23 +142,21 @@ func JobForMySqlRestore(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme
 						},
 					}},
 					Volumes: []corev1.Volume{
-						{
-							Name: recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
-								},
-							},
-						},
+						backupVolumeForRecipe(recipe),
 					},
 					RestartPolicy: "OnFailure",
 				},
 			},
 		},
 	}
-	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
-		return nil, err
+	if targetTime != nil {
+		withTargetTime(recipe, &job.Spec.Template.Spec.Containers[0], *targetTime)
 	}
+	withJobDatabaseTLS(recipe, &job.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &job.Spec.Template)
+	withScheduling(&job.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withS3Download(recipe, &job.Spec.Template.Spec)
+	withCommonMetadata(recipe, job, &job.Spec.Template)
 
-	return job, nil
+	return job
 }
@@ -0,0 +1,158 @@
+package resources
+
+import (
+	"sort"
+	"strings"
+
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PropagatedLabelsAnnotation lists the keys of the labels propagated from the Recipe
+	PropagatedLabelsAnnotation = "devconfcz.opdev.com/propagated-labels"
+	// PropagatedAnnotationsAnnotation lists the keys of the annotations propagated from the Recipe
+	PropagatedAnnotationsAnnotation = "devconfcz.opdev.com/propagated-annotations"
+	// ManagedAnnotationsAnnotation lists the keys of the annotations set from
+	// spec.service.annotations or spec.expose.annotations
+	ManagedAnnotationsAnnotation = "devconfcz.opdev.com/managed-annotations"
+)
+
+// PropagateMetadata sets spec.commonLabels and spec.commonAnnotations on the
+// object and reports whether it changed
+func PropagateMetadata(recipe *devconfczv1alpha1.Recipe, object metav1.Object) bool {
+	return propagateMetadata(object, recipe.Spec.CommonLabels, recipe.Spec.CommonAnnotations)
+}
+
+// PropagatePodMetadata sets spec.commonLabels, spec.commonAnnotations and
+// spec.podAnnotations on the pod template and reports whether it changed
+func PropagatePodMetadata(recipe *devconfczv1alpha1.Recipe, template *corev1.PodTemplateSpec) bool {
+	annotations := recipe.Spec.CommonAnnotations
+	if len(recipe.Spec.PodAnnotations) > 0 {
+		annotations = make(map[string]string, len(recipe.Spec.CommonAnnotations)+len(recipe.Spec.PodAnnotations))
+		for key, value := range recipe.Spec.CommonAnnotations {
+			annotations[key] = value
+		}
+		for key, value := range recipe.Spec.PodAnnotations {
+			annotations[key] = value
+		}
+	}
+	return propagateMetadata(template, recipe.Spec.CommonLabels, annotations)
+}
+
+// withCommonMetadata propagates the labels and annotations of the Recipe to a
+// new object and to its pod template
+func withCommonMetadata(recipe *devconfczv1alpha1.Recipe, object metav1.Object, templates ...*corev1.PodTemplateSpec) {
+	PropagateMetadata(recipe, object)
+	for _, template := range templates {
+		PropagatePodMetadata(recipe, template)
+	}
+}
+
+// propagateMetadata sets the labels and annotations on the object, keeping
+// those set by the operator, and removes the ones it previously propagated
+// which are no longer set. The propagated keys are recorded in annotations.
+func propagateMetadata(object metav1.Object, labels, annotations map[string]string) bool {
+	foundAnnotations := object.GetAnnotations()
+	// The annotations set from the spec of the object take precedence
+	previousAnnotations := splitKeys(foundAnnotations[PropagatedAnnotationsAnnotation])
+	for key := range splitKeys(foundAnnotations[ManagedAnnotationsAnnotation]) {
+		delete(previousAnnotations, key)
+	}
+	newLabels, labelKeys := propagate(object.GetLabels(), labels, splitKeys(foundAnnotations[PropagatedLabelsAnnotation]))
+	newAnnotations, annotationKeys := propagate(foundAnnotations, annotations, previousAnnotations)
+	setPropagatedKeys(newAnnotations, PropagatedLabelsAnnotation, labelKeys)
+	setPropagatedKeys(newAnnotations, PropagatedAnnotationsAnnotation, annotationKeys)
+
+	changed := false
+	if !equality.Semantic.DeepEqual(object.GetLabels(), newLabels) {
+		object.SetLabels(newLabels)
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(foundAnnotations, newAnnotations) {
+		object.SetAnnotations(newAnnotations)
+		changed = true
+	}
+	return changed
+}
+
+// propagate returns a copy of found with the desired values, except those of
+// keys set otherwise, and without the previously propagated keys which are no
+// longer desired, along with the propagated keys
+func propagate(found, desired map[string]string, previousKeys map[string]bool) (map[string]string, []string) {
+	result := make(map[string]string, len(found)+len(desired))
+	for key, value := range found {
+		if _, ok := desired[key]; previousKeys[key] && !ok {
+			continue
+		}
+		result[key] = value
+	}
+	keys := []string{}
+	for key, value := range desired {
+		if _, ok := found[key]; ok && !previousKeys[key] {
+			continue
+		}
+		result[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return result, keys
+}
+
+// setPropagatedKeys records the propagated keys in the annotation, or removes
+// it when no key is propagated
+func setPropagatedKeys(annotations map[string]string, annotation string, keys []string) {
+	if len(keys) == 0 {
+		delete(annotations, annotation)
+		return
+	}
+	annotations[annotation] = strings.Join(keys, ",")
+}
+
+// splitKeys returns the set of the keys recorded in an annotation
+func splitKeys(list string) map[string]bool {
+	keys := map[string]bool{}
+	if list != "" {
+		for _, key := range strings.Split(list, ",") {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// withManagedAnnotations sets the annotations of the spec on a new object and
+// records their keys, so that they are removed once dropped from the spec
+func withManagedAnnotations(object metav1.Object, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+	managed := make(map[string]string, len(annotations)+1)
+	for key, value := range annotations {
+		managed[key] = value
+	}
+	setPropagatedKeys(managed, ManagedAnnotationsAnnotation, sortedKeys(annotations))
+	object.SetAnnotations(managed)
+}
+
+// ManageAnnotations returns a copy of the found annotations with the managed
+// annotations of the desired ones set, and without the previously managed
+// keys which are no longer desired. Annotations added by other controllers
+// are kept.
+func ManageAnnotations(found, desired map[string]string) map[string]string {
+	previousKeys := splitKeys(found[ManagedAnnotationsAnnotation])
+	managedKeys := splitKeys(desired[ManagedAnnotationsAnnotation])
+	result := make(map[string]string, len(found)+len(managedKeys))
+	for key, value := range found {
+		if previousKeys[key] && !managedKeys[key] {
+			continue
+		}
+		result[key] = value
+	}
+	for key := range managedKeys {
+		result[key] = desired[key]
+	}
+	setPropagatedKeys(result, ManagedAnnotationsAnnotation, sortedKeys(managedKeys))
+	return result
+}
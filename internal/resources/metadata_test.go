@@ -0,0 +1,151 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPropagate(t *testing.T) {
+	tests := []struct {
+		name     string
+		found    map[string]string
+		desired  map[string]string
+		previous map[string]bool
+		want     map[string]string
+		wantKeys []string
+	}{
+		{
+			name:     "new keys",
+			found:    map[string]string{"other": "x"},
+			desired:  map[string]string{"team": "recipes", "env": "prod"},
+			want:     map[string]string{"other": "x", "team": "recipes", "env": "prod"},
+			wantKeys: []string{"env", "team"},
+		},
+		{
+			name:     "changed value",
+			found:    map[string]string{"team": "recipes"},
+			desired:  map[string]string{"team": "kitchen"},
+			previous: map[string]bool{"team": true},
+			want:     map[string]string{"team": "kitchen"},
+			wantKeys: []string{"team"},
+		},
+		{
+			name:     "removed key",
+			found:    map[string]string{"team": "recipes", "env": "prod", "other": "x"},
+			desired:  map[string]string{"team": "recipes"},
+			previous: map[string]bool{"team": true, "env": true},
+			want:     map[string]string{"team": "recipes", "other": "x"},
+			wantKeys: []string{"team"},
+		},
+		{
+			name:     "all keys removed",
+			found:    map[string]string{"team": "recipes", "other": "x"},
+			previous: map[string]bool{"team": true},
+			want:     map[string]string{"other": "x"},
+			wantKeys: []string{},
+		},
+		{
+			name:     "key set otherwise",
+			found:    map[string]string{"team": "others"},
+			desired:  map[string]string{"team": "recipes"},
+			want:     map[string]string{"team": "others"},
+			wantKeys: []string{},
+		},
+		{
+			name:     "key set otherwise not removed",
+			found:    map[string]string{"team": "others"},
+			previous: map[string]bool{},
+			want:     map[string]string{"team": "others"},
+			wantKeys: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, keys := propagate(tt.found, tt.desired, tt.previous)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("propagate() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("propagate() keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestPropagateMetadataRecordsKeys(t *testing.T) {
+	object := &metav1.ObjectMeta{
+		Labels:      map[string]string{"app": "recipe"},
+		Annotations: map[string]string{"other": "x"},
+	}
+	if !propagateMetadata(object, map[string]string{"team": "recipes"}, map[string]string{"owner": "kitchen"}) {
+		t.Fatal("propagateMetadata() = false, want true")
+	}
+	if propagateMetadata(object, map[string]string{"team": "recipes"}, map[string]string{"owner": "kitchen"}) {
+		t.Error("propagateMetadata() = true when nothing changed")
+	}
+	if !propagateMetadata(object, nil, nil) {
+		t.Fatal("propagateMetadata() = false when the keys are removed")
+	}
+	if want := map[string]string{"app": "recipe"}; !reflect.DeepEqual(object.Labels, want) {
+		t.Errorf("labels = %v, want %v", object.Labels, want)
+	}
+	if want := map[string]string{"other": "x"}; !reflect.DeepEqual(object.Annotations, want) {
+		t.Errorf("annotations = %v, want %v", object.Annotations, want)
+	}
+}
+
+func TestManageAnnotations(t *testing.T) {
+	managed := func(annotations map[string]string) map[string]string {
+		object := &corev1.Service{}
+		withManagedAnnotations(object, annotations)
+		return object.Annotations
+	}
+
+	tests := []struct {
+		name    string
+		found   map[string]string
+		desired map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "new annotation",
+			found:   map[string]string{"other": "x"},
+			desired: managed(map[string]string{"lb": "internal"}),
+			want:    map[string]string{"other": "x", "lb": "internal", ManagedAnnotationsAnnotation: "lb"},
+		},
+		{
+			name:    "changed annotation set otherwise",
+			found:   map[string]string{"lb": "external"},
+			desired: managed(map[string]string{"lb": "internal"}),
+			want:    map[string]string{"lb": "internal", ManagedAnnotationsAnnotation: "lb"},
+		},
+		{
+			name:    "removed annotation",
+			found:   map[string]string{"other": "x", "lb": "internal", "timeout": "30s", ManagedAnnotationsAnnotation: "lb,timeout"},
+			desired: managed(map[string]string{"timeout": "30s"}),
+			want:    map[string]string{"other": "x", "timeout": "30s", ManagedAnnotationsAnnotation: "timeout"},
+		},
+		{
+			name:    "all annotations removed",
+			found:   map[string]string{"other": "x", "lb": "internal", ManagedAnnotationsAnnotation: "lb"},
+			desired: managed(nil),
+			want:    map[string]string{"other": "x"},
+		},
+		{
+			name:    "common annotations left alone",
+			found:   map[string]string{"owner": "kitchen", PropagatedAnnotationsAnnotation: "owner"},
+			desired: map[string]string{"owner": "kitchen", PropagatedAnnotationsAnnotation: "owner"},
+			want:    map[string]string{"owner": "kitchen", PropagatedAnnotationsAnnotation: "owner"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ManageAnnotations(tt.found, tt.desired); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ManageAnnotations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -31,6 +31,12 @@ var secContext = &corev1.SecurityContext{
 	},
 }
 
+// MySQLConfigHashAnnotation is set on the pod template of MySQL with the hash of its my.cnf
+const MySQLConfigHashAnnotation = "devconfcz.opdev.com/mysql-config-hash"
+
+// MySQLDataVolume is the volume of the MySQL pods holding the PVC of the database
+const MySQLDataVolume = "mysql-persistent-storage"
+
 var databaseImage = "image-registry.openshift-image-registry.svc:5000/openshift/mysql@sha256:8e9a6595ac9aec17c62933d3b5ecc78df8174a6c2ff74c7f602235b9aef0a340"
 
 func MysqlDeploymentForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*appsv1.Deployment, error) {
@@ -40,8 +46,9 @@ func MysqlDeploymentForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.
 	if recipe.Spec.Database.SecurityContext != nil {
 		secContext = recipe.Spec.Database.SecurityContext
 	}
+	image := databaseImage
 	if recipe.Spec.Database.Image != "" {
-		databaseImage = recipe.Spec.Database.Image
+		image = recipe.Spec.Database.Image
 	}
 	replicas := int32(1)
 	dep := &appsv1.Deployment{
@@ -56,21 +63,31 @@ func MysqlDeploymentForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.
 					"app": recipe.Name + "-mysql",
 				},
 			},
+			// Stop the running server before starting a new one on the same volume
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: map[string]string{
 						"app": recipe.Name + "-mysql",
 					},
+					Annotations: map[string]string{
+						MySQLConfigHashAnnotation: mysqlServerConfigHash(recipe),
+					},
 				},
 				Spec: corev1.PodSpec{
 					SecurityContext: &podSecContext,
 					Containers: []corev1.Container{{
-						Image: databaseImage,
+						Image: image,
 						Name:  "mysql",
-						Args: []string{
-							"--ignore-db-dir=lost+found",
-						},
+						Args: append([]string{
+							// MySQL 5.7 skips the lost+found of the volume, 8.0 removed the
+							// option and only warns about it with the loose- prefix
+							"--loose-ignore-db-dir=lost+found",
+						}, binlogArgsForRecipe(recipe)...),
 						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources:       recipe.Spec.Database.Resources,
 						Ports: []corev1.ContainerPort{
 							{
 								ContainerPort: 3306,
@@ -121,30 +138,42 @@ func MysqlDeploymentForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.
 						},
 						VolumeMounts: []corev1.VolumeMount{
 							{
-								Name:      "mysql-persistent-storage",
+								Name:      MySQLDataVolume,
 								MountPath: "/var/lib/mysql",
 							},
 							{
 								Name:      "mysql-initdb",
 								MountPath: "/docker-entrypoint-initdb.d",
 							},
+							{
+								Name:      "mysql-cnf",
+								MountPath: "/etc/mysql/conf.d/recipe.cnf",
+								SubPath:   "recipe.cnf",
+							},
 						},
 						SecurityContext: secContext,
 					}},
 					Volumes: []corev1.Volume{
 						{
-							Name: "mysql-persistent-storage",
+							Name: MySQLDataVolume,
 							VolumeSource: corev1.VolumeSource{
 								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: recipe.Name + "-mysql",
+									ClaimName: DatabaseClaimName(recipe),
 								},
 							},
 						},
 						{Name: "mysql-initdb",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: initScriptsForRecipe(recipe),
+								},
+							},
+						},
+						{Name: "mysql-cnf",
 							VolumeSource: corev1.VolumeSource{
 								ConfigMap: &corev1.ConfigMapVolumeSource{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: recipe.Name + "-mysql-initdb-config",
+										Name: recipe.Name + "-mysql-cnf",
 									},
 								},
 							},
@@ -154,9 +183,22 @@ func MysqlDeploymentForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.
 			},
 		},
 	}
+	withMySQLProbes(&dep.Spec.Template.Spec.Containers[0])
+	withMySQLTLS(recipe, &dep.Spec.Template.Spec)
+	withBinlogTimeline(recipe, &dep.Spec.Template.Spec)
+	withScheduling(&dep.Spec.Template.Spec, recipe.Spec.Database.Scheduling)
+	withCommonMetadata(recipe, dep, &dep.Spec.Template)
 	// Set the ownerRef for the Deployment
 	if err := ctrl.SetControllerReference(recipe, dep, scheme); err != nil {
 		return nil, err
 	}
 	return dep, nil
 }
+
+// SetMySQLImage sets the image of the MySQL container and of its init containers
+func SetMySQLImage(podSpec *corev1.PodSpec, image string) {
+	podSpec.Containers[0].Image = image
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].Image = image
+	}
+}
@@ -0,0 +1,171 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// DatabaseClientLabel marks the pods of the recipe app and of the Jobs
+	// allowed to connect to the MySQL of the Recipe named by its value
+	DatabaseClientLabel = "devconfcz.opdev.com/database-client"
+	// CloneSourceLabel marks the pods of the clone Jobs allowed to connect to
+	// the MySQL of the source Recipe named by its value
+	CloneSourceLabel = "devconfcz.opdev.com/clone-source"
+)
+
+// NetworkPolicyEnabled reports whether the traffic to MySQL and to the recipe app is restricted
+func NetworkPolicyEnabled(recipe *devconfczv1alpha1.Recipe) bool {
+	return recipe.Spec.NetworkPolicy != nil && recipe.Spec.NetworkPolicy.Enabled
+}
+
+// withDatabaseClientLabel allows the pods of the template to connect to MySQL
+func withDatabaseClientLabel(recipe *devconfczv1alpha1.Recipe, template *corev1.PodTemplateSpec) {
+	if template.Labels == nil {
+		template.Labels = map[string]string{}
+	}
+	template.Labels[DatabaseClientLabel] = recipe.Name
+}
+
+// MySQLNetworkPolicyForRecipe creates a NetworkPolicy only allowing the
+// database clients of the recipe, and the clone Jobs of the namespaces of
+// spec.cloneAllowedNamespaces, to reach MySQL, and sets the owner reference
+func MySQLNetworkPolicyForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*networkingv1.NetworkPolicy, error) {
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(3306)
+	from := []networkingv1.NetworkPolicyPeer{
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					DatabaseClientLabel: recipe.Name,
+				},
+			},
+		},
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					CloneSourceLabel: recipe.Name,
+				},
+			},
+		},
+	}
+	if len(recipe.Spec.CloneAllowedNamespaces) > 0 {
+		namespaces := &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{
+					Key:      corev1.LabelMetadataName,
+					Operator: metav1.LabelSelectorOpIn,
+					Values:   recipe.Spec.CloneAllowedNamespaces,
+				},
+			},
+		}
+		for _, namespace := range recipe.Spec.CloneAllowedNamespaces {
+			if namespace == "*" {
+				namespaces = &metav1.LabelSelector{}
+			}
+		}
+		from = append(from, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: namespaces,
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					CloneSourceLabel: recipe.Name,
+				},
+			},
+		})
+	}
+
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-mysql",
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": recipe.Name + "-mysql",
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{
+							Protocol: &tcp,
+							Port:     &port,
+						},
+					},
+					From: from,
+				},
+			},
+		},
+	}
+
+	withCommonMetadata(recipe, networkPolicy)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, networkPolicy, scheme); err != nil {
+		return nil, err
+	}
+
+	return networkPolicy, nil
+}
+
+// AppNetworkPolicyForRecipe creates a NetworkPolicy only allowing the peers
+// of spec.networkPolicy.appIngressFrom, or the pods of the namespace of the
+// recipe without peers, to reach the recipe app, and sets the owner reference
+func AppNetworkPolicyForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*networkingv1.NetworkPolicy, error) {
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(5000)
+	from := recipe.Spec.NetworkPolicy.AppIngressFrom
+	if len(from) == 0 {
+		from = []networkingv1.NetworkPolicyPeer{
+			{
+				PodSelector: &metav1.LabelSelector{},
+			},
+		}
+	}
+
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name,
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": recipe.Name,
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{
+							Protocol: &tcp,
+							Port:     &port,
+						},
+					},
+					From: from,
+				},
+			},
+		},
+	}
+
+	withCommonMetadata(recipe, networkPolicy)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, networkPolicy, scheme); err != nil {
+		return nil, err
+	}
+
+	return networkPolicy, nil
+}
@@ -0,0 +1,82 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// appMinReplicas returns the least number of replicas the recipe app runs
+// with, the minimum of the autoscaler when it is set
+func appMinReplicas(recipe *devconfczv1alpha1.Recipe) int32 {
+	if recipe.Spec.Hpa != nil {
+		if recipe.Spec.Hpa.MinReplicas != nil {
+			return *recipe.Spec.Hpa.MinReplicas
+		}
+		return 1
+	}
+	return recipe.Spec.Replicas
+}
+
+// PodDisruptionBudgetForRecipe creates a PodDisruptionBudget keeping all but
+// one of the minimum replicas of the recipe app available during voluntary
+// disruptions, and sets the owner reference. With a single replica, it only
+// limits disruptions to one pod at a time, not to block node drains forever.
+func PodDisruptionBudgetForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*policyv1.PodDisruptionBudget, error) {
+	pdb := podDisruptionBudget(recipe, recipe.Name)
+	if replicas := appMinReplicas(recipe); replicas > 1 {
+		minAvailable := intstr.FromInt32(replicas - 1)
+		pdb.Spec.MinAvailable = &minAvailable
+	} else {
+		maxUnavailable := intstr.FromInt32(1)
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	}
+
+	withCommonMetadata(recipe, pdb)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, pdb, scheme); err != nil {
+		return nil, err
+	}
+
+	return pdb, nil
+}
+
+// MySQLPodDisruptionBudgetForRecipe creates a PodDisruptionBudget for the
+// single MySQL pod and sets the owner reference. It allows the pod to be
+// evicted, not to block node drains forever, but at most one at a time.
+func MySQLPodDisruptionBudgetForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*policyv1.PodDisruptionBudget, error) {
+	pdb := podDisruptionBudget(recipe, recipe.Name+"-mysql")
+	maxUnavailable := intstr.FromInt32(1)
+	pdb.Spec.MaxUnavailable = &maxUnavailable
+
+	withCommonMetadata(recipe, pdb)
+	// Set owner reference
+	if err := ctrl.SetControllerReference(recipe, pdb, scheme); err != nil {
+		return nil, err
+	}
+
+	return pdb, nil
+}
+
+// podDisruptionBudget returns a PodDisruptionBudget selecting the pods labeled with app
+func podDisruptionBudget(recipe *devconfczv1alpha1.Recipe, app string) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app,
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": app,
+				},
+			},
+		},
+	}
+}
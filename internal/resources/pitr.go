@@ -0,0 +1,304 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// BinlogArchiveLabel marks the binary log archive CronJob and its Jobs
+const BinlogArchiveLabel = "binlog-archive"
+
+// defaultBinlogArchiveSchedule is used when pointInTimeRecovery sets no archiveSchedule
+const defaultBinlogArchiveSchedule = "*/5 * * * *"
+
+// binlogArchiveScript closes the current binary log and copies every closed
+// binary log which is not archived yet into /backup/binlog/<server UUID>, the
+// timeline of the data directory of MySQL. With S3, the binary logs already
+// uploaded are listed in /backup/binlog.archived.
+const binlogArchiveScript = `set -eo pipefail
+MYSQL_AUTH=(-h "${MYSQL_HOST}" -u root -p"${MYSQL_ROOT_PASSWORD}" ${MYSQL_SSL_OPTS})
+SERVER_UUID="$(mysql "${MYSQL_AUTH[@]}" -N -e "SELECT @@server_uuid")"
+BINLOG_DIR="/backup/binlog/${SERVER_UUID}"
+mkdir -p "${BINLOG_DIR}"
+mysql "${MYSQL_AUTH[@]}" -e "FLUSH BINARY LOGS"
+BINLOGS="$(mysql "${MYSQL_AUTH[@]}" -N -e "SHOW BINARY LOGS" | cut -f1 | head -n -1)"
+ARCHIVED=0
+for BINLOG in ${BINLOGS}; do
+  if [ -f "${BINLOG_DIR}/${BINLOG}" ] || grep -qx "${SERVER_UUID}/${BINLOG}" /backup/binlog.archived 2> /dev/null; then
+    continue
+  fi
+  echo "=> Archive binary log ${SERVER_UUID}/${BINLOG}"
+  mysqlbinlog --read-from-remote-server --raw "${MYSQL_AUTH[@]}" --result-file="${BINLOG_DIR}/" "${BINLOG}"
+  ARCHIVED=$((ARCHIVED + 1))
+done
+echo "Archived ${ARCHIVED} binary logs" | tee /dev/termination-log
+`
+
+// binlogTimelineScript makes MySQL generate a new server UUID, and thus start
+// a new timeline of archived binary logs, when it starts on a data directory
+// copied to another volume, e.g. restored from a VolumeSnapshot, whose binary
+// logs would otherwise collide with those archived from the original volume.
+// The volume a data directory was last started on is recorded in it, those
+// without record are assumed to come from DATABASE_CLAIM_ORIGIN.
+const binlogTimelineScript = `set -eo pipefail
+[ -f /var/lib/mysql/auto.cnf ] || exit 0
+MARKED="$(cat /var/lib/mysql/.database-claim 2> /dev/null || true)"
+if [ "${MARKED:-${DATABASE_CLAIM_ORIGIN}}" != "${DATABASE_CLAIM}" ]; then
+  echo "=> Generate a new server UUID for the data directory copied to ${DATABASE_CLAIM}"
+  rm -f /var/lib/mysql/auto.cnf
+fi
+echo "${DATABASE_CLAIM}" > /var/lib/mysql/.database-claim
+`
+
+// binlogTimelineContainer is the init container of MySQL running binlogTimelineScript
+const binlogTimelineContainer = "binlog-timeline"
+
+// backupBefore defines backup_before, which reads backup paths on stdin and
+// prints the most recent one, without the prefix given as second argument,
+// whose timestamp is before the first argument.
+const backupBefore = `backup_before() {
+  while read -r BACKUP; do
+    BACKUP="${BACKUP#$2}"
+    STAMP="$(basename "${BACKUP}")"
+    if [[ "${STAMP:0:12}" < "$1" ]]; then echo "${STAMP:0:12} ${BACKUP}"; fi
+  done | sort | tail -n 1 | cut -d" " -f2
+}
+`
+
+// binlogReplay replays the archived binary logs from the position recorded in
+// BACKUP_FILE up to TARGET_TIME, when a target time is requested.
+const binlogReplay = `if [ -n "${TARGET_TIME}" ]; then
+  BINLOG_POSITION="$(decode_backup "${BACKUP_FILE}" | sed -n "s/^-- CHANGE .*_LOG_FILE='\([^']*\)', *[A-Z]*_LOG_POS=\([0-9]*\).*/\1 \2/p")"
+  read -r START_FILE START_POS <<< "${BINLOG_POSITION}"
+  if [ -z "${START_FILE}" ]; then
+    echo "$(basename "${BACKUP_FILE}") has no binary log position, it was taken before point-in-time recovery was enabled" | tee /dev/termination-log
+    exit 1
+  fi
+  # Only replay the binary logs of the data directory the backup was taken
+  # from, backups taken before they were archived per server have no UUID
+  SERVER_UUID="$(decode_backup "${BACKUP_FILE}" | sed -n "s/^-- Server UUID: \([0-9a-f-]*\)$/\1/p")"
+  BINLOG_DIR="/backup/binlog${SERVER_UUID:+/${SERVER_UUID}}"
+  BINLOGS=()
+  for BINLOG in "${BINLOG_DIR}"/*.[0-9]*; do
+    [ -f "${BINLOG}" ] || continue
+    if [[ ! "$(basename "${BINLOG}")" < "${START_FILE}" ]]; then BINLOGS+=("${BINLOG}"); fi
+  done
+  if [ "${#BINLOGS[@]}" -eq 0 ] || [ "$(basename "${BINLOGS[0]}")" != "${START_FILE}" ]; then
+    echo "Binary log ${START_FILE} has not been archived yet" | tee /dev/termination-log
+    exit 1
+  fi
+  echo "=> Replay binary logs from ${START_FILE}:${START_POS} until ${TARGET_TIME}"
+  mysqlbinlog --database="${MYSQL_DATABASE}" --start-position="${START_POS}" --stop-datetime="${TARGET_TIME}" "${BINLOGS[@]}" | mysql -h "${MYSQL_HOST}" -u root -p"${MYSQL_ROOT_PASSWORD}" ${MYSQL_SSL_OPTS}
+fi
+`
+
+// binlogArgsForRecipe returns the MySQL server arguments enabling the binary
+// log when point-in-time recovery is enabled.
+func binlogArgsForRecipe(recipe *devconfczv1alpha1.Recipe) []string {
+	if recipe.Spec.Database.BackupPolicy.PointInTimeRecovery == nil {
+		return nil
+	}
+	return []string{
+		"--log-bin=mysql-bin",
+		"--binlog-format=ROW",
+		"--server-id=1",
+	}
+}
+
+// withBinlogPosition makes the backup container record the binary log
+// position of the dump and the server UUID of its timeline, which requires
+// the root user, when point-in-time recovery is enabled.
+func withBinlogPosition(recipe *devconfczv1alpha1.Recipe, container *corev1.Container) {
+	if recipe.Spec.Database.BackupPolicy.PointInTimeRecovery == nil {
+		return
+	}
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "RECORD_SERVER_UUID",
+		Value: "true",
+	})
+	for i, env := range container.Env {
+		switch env.Name {
+		case "MYSQLDUMP_OPTS":
+			container.Env[i].Value = env.Value + " --master-data=2"
+		case "MYSQL_USER":
+			container.Env[i] = corev1.EnvVar{
+				Name:  "MYSQL_USER",
+				Value: "root",
+			}
+		case "MYSQL_PASSWORD":
+			container.Env[i] = corev1.EnvVar{
+				Name: "MYSQL_PASSWORD",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: recipe.Name + "-mysql",
+						},
+						Key: "MYSQL_ROOT_PASSWORD",
+					},
+				},
+			}
+		}
+	}
+}
+
+// withBinlogTimeline adds the init container giving MySQL a new server UUID
+// on a copied data directory, when point-in-time recovery is enabled
+func withBinlogTimeline(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec) {
+	if recipe.Spec.Database.BackupPolicy.PointInTimeRecovery == nil {
+		return
+	}
+	mysql := podSpec.Containers[0]
+	var dataMounts []corev1.VolumeMount
+	for _, mount := range mysql.VolumeMounts {
+		if mount.Name == MySQLDataVolume {
+			dataMounts = append(dataMounts, mount)
+		}
+	}
+	podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+		Image:           mysql.Image,
+		Name:            binlogTimelineContainer,
+		ImagePullPolicy: mysql.ImagePullPolicy,
+		Command:         []string{"/bin/bash", "-c", binlogTimelineScript},
+		Env: []corev1.EnvVar{
+			{
+				Name:  "DATABASE_CLAIM",
+				Value: DatabaseClaimName(recipe),
+			},
+			{
+				Name:  "DATABASE_CLAIM_ORIGIN",
+				Value: recipe.Name + "-mysql",
+			},
+		},
+		VolumeMounts:    dataMounts,
+		SecurityContext: mysql.SecurityContext,
+	})
+}
+
+// withTargetTime makes the restore container replay the archived binary logs
+// up to targetTime. mysqlbinlog ships with the database image, which is
+// therefore used to restore.
+func withTargetTime(recipe *devconfczv1alpha1.Recipe, container *corev1.Container, targetTime metav1.Time) {
+	image := databaseImage
+	if recipe.Spec.Database.Image != "" {
+		image = recipe.Spec.Database.Image
+	}
+	container.Image = image
+	container.Env = append(container.Env, []corev1.EnvVar{
+		{
+			Name:  "TZ",
+			Value: "UTC",
+		},
+		{
+			Name:  "TARGET_TIME",
+			Value: targetTime.UTC().Format("2006-01-02 15:04:05"),
+		},
+		{
+			Name:  "TARGET_STAMP",
+			Value: targetTime.UTC().Format("200601021504"),
+		},
+	}...)
+}
+
+// CronJobForBinlogArchive creates a CronJob that archives the binary logs of the MySQL Database
+func CronJobForBinlogArchive(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.CronJob, error) {
+	image := databaseImage
+	if recipe.Spec.Database.Image != "" {
+		image = recipe.Spec.Database.Image
+	}
+
+	schedule := recipe.Spec.Database.BackupPolicy.PointInTimeRecovery.ArchiveSchedule
+	if schedule == "" {
+		schedule = defaultBinlogArchiveSchedule
+	}
+
+	var timeZone *string
+	if recipe.Spec.Database.BackupPolicy.Tmz != "" {
+		timeZone = &recipe.Spec.Database.BackupPolicy.Tmz
+	}
+
+	labels := map[string]string{
+		"app":              recipe.Name,
+		BinlogArchiveLabel: "true",
+	}
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-binlog-archive",
+			Namespace: recipe.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			Schedule:          schedule,
+			TimeZone:          timeZone,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{
+								Image:                    image,
+								Name:                     "binlog-archive",
+								ImagePullPolicy:          corev1.PullIfNotPresent,
+								Resources:                recipe.Spec.Database.JobResources,
+								Command:                  []string{"/bin/bash", "-c", binlogArchiveScript},
+								TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+								Env: []corev1.EnvVar{
+									{
+										Name: "MYSQL_HOST",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: recipe.Name + "-mysql-config",
+												},
+												Key: "DB_HOST",
+											},
+										},
+									}, {
+										Name: "MYSQL_ROOT_PASSWORD",
+										ValueFrom: &corev1.EnvVarSource{
+											SecretKeyRef: &corev1.SecretKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: recipe.Name + "-mysql",
+												},
+												Key: "MYSQL_ROOT_PASSWORD",
+											},
+										},
+									},
+								},
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
+										MountPath: "/backup",
+									},
+								},
+							}},
+							Volumes: []corev1.Volume{
+								backupVolumeForRecipe(recipe),
+							},
+							RestartPolicy: "OnFailure",
+						},
+					},
+				},
+			},
+		},
+	}
+	withJobDatabaseTLS(recipe, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &cronJob.Spec.JobTemplate.Spec.Template)
+	withScheduling(&cronJob.Spec.JobTemplate.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withS3BinlogArchive(recipe, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+
+	withCommonMetadata(recipe, cronJob, &cronJob.Spec.JobTemplate.Spec.Template)
+	PropagateMetadata(recipe, &cronJob.Spec.JobTemplate)
+	if err := ctrl.SetControllerReference(recipe, cronJob, scheme); err != nil {
+		return nil, err
+	}
+
+	return cronJob, nil
+}
@@ -0,0 +1,207 @@
+package resources
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeMySQL answers the queries of the scripts with the server UUID and the
+// binary logs of the fake server, and swallows the SQL piped into it
+const fakeMySQL = `#!/bin/bash
+case "$*" in
+  *"SELECT @@server_uuid"*) echo "${FAKE_SERVER_UUID}" ;;
+  *"SHOW BINARY LOGS"*) for BINLOG in ${FAKE_BINLOGS}; do printf '%s\t100\n' "${BINLOG}"; done ;;
+  *"FLUSH BINARY LOGS"*) ;;
+  *) cat > /dev/null ;;
+esac
+`
+
+// fakeMySQLBinlog copies a binary log of the fake server, whose content names
+// the server it comes from, or records the binary logs it replays
+const fakeMySQLBinlog = `#!/bin/bash
+if [[ " $* " == *" --read-from-remote-server "* ]]; then
+  for ARG; do case "${ARG}" in --result-file=*) DIR="${ARG#--result-file=}" ;; esac; done
+  BINLOG="${@: -1}"
+  echo "${FAKE_SERVER_UUID} ${BINLOG}" > "${DIR}${BINLOG}"
+else
+  for ARG; do case "${ARG}" in /*) echo "${ARG#${FAKE_BACKUP_ROOT}/}" >> "${FAKE_REPLAY_LOG}" ;; esac; done
+fi
+`
+
+// fakeMySQLDump prints a dump recording the binary log position of the fake server
+const fakeMySQLDump = `#!/bin/bash
+echo "-- CHANGE MASTER TO MASTER_LOG_FILE='${FAKE_DUMP_BINLOG}', MASTER_LOG_POS=154;"
+echo "CREATE TABLE recipe (id INT);"
+`
+
+// scriptRunner runs the scripts of the Jobs with /backup in a temporary
+// directory and fake MySQL clients
+type scriptRunner struct {
+	t      *testing.T
+	root   string
+	bin    string
+	server string
+}
+
+func newScriptRunner(t *testing.T) *scriptRunner {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	dir := t.TempDir()
+	runner := &scriptRunner{t: t, root: filepath.Join(dir, "backup"), bin: filepath.Join(dir, "bin")}
+	for _, d := range []string{runner.root, runner.bin} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{"mysql": fakeMySQL, "mysqlbinlog": fakeMySQLBinlog, "mysqldump": fakeMySQLDump} {
+		if err := os.WriteFile(filepath.Join(runner.bin, name), []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return runner
+}
+
+// run runs the script against the fake server holding the binary logs
+func (r *scriptRunner) run(script string, binlogs []string, env ...string) string {
+	r.t.Helper()
+	script = strings.ReplaceAll(script, "/dev/termination-log", filepath.Join(r.root, "..", "termination-log"))
+	script = strings.ReplaceAll(script, "/backup", r.root)
+	cmd := exec.Command("bash", "-c", script)
+	cmd.Env = append(os.Environ(),
+		"PATH="+r.bin+":"+os.Getenv("PATH"),
+		"MYSQL_HOST=mysql",
+		"MYSQL_DATABASE=recipes",
+		"MYSQL_USER=root",
+		"BACKUP_COMPRESSION=none",
+		"FAKE_SERVER_UUID="+r.server,
+		"FAKE_BINLOGS="+strings.Join(binlogs, " "),
+		"FAKE_BACKUP_ROOT="+r.root,
+		"FAKE_REPLAY_LOG="+filepath.Join(r.root, "..", "replay.log"),
+	)
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("script failed: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+// archived returns the content of an archived binary log, empty when it is missing
+func (r *scriptRunner) archived(path string) string {
+	content, err := os.ReadFile(filepath.Join(r.root, "binlog", path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func TestBinlogArchiveAfterReinitialization(t *testing.T) {
+	r := newScriptRunner(t)
+
+	// The original data directory takes a backup and archives its binary logs
+	r.server = "aaaaaaaa-0000-0000-0000-000000000000"
+	backupA := strings.TrimSpace(r.run(backupScript+"cat /dev/termination-log\n", nil,
+		"RECORD_SERVER_UUID=true", "FAKE_DUMP_BINLOG=mysql-bin.000002", "MAX_BACKUPS=5", "BACKUP_GENERATION=daily"))
+	backupA = backupA[strings.LastIndex(backupA, "\n")+1:]
+	r.run(binlogArchiveScript, []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003", "mysql-bin.000004"})
+
+	// The volume is re-created, e.g. by an upgrade rollback or a snapshot
+	// restore, and numbers its binary logs from the start again
+	r.server = "bbbbbbbb-0000-0000-0000-000000000000"
+	r.run(binlogArchiveScript, []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003"})
+
+	for path, want := range map[string]string{
+		"aaaaaaaa-0000-0000-0000-000000000000/mysql-bin.000001": "aaaaaaaa-0000-0000-0000-000000000000 mysql-bin.000001",
+		"aaaaaaaa-0000-0000-0000-000000000000/mysql-bin.000003": "aaaaaaaa-0000-0000-0000-000000000000 mysql-bin.000003",
+		"bbbbbbbb-0000-0000-0000-000000000000/mysql-bin.000001": "bbbbbbbb-0000-0000-0000-000000000000 mysql-bin.000001",
+		"bbbbbbbb-0000-0000-0000-000000000000/mysql-bin.000002": "bbbbbbbb-0000-0000-0000-000000000000 mysql-bin.000002",
+		// The binary log still being written is not archived yet
+		"bbbbbbbb-0000-0000-0000-000000000000/mysql-bin.000003": "",
+	} {
+		if got := r.archived(path); got != want {
+			t.Errorf("archived %s = %q, want %q", path, got, want)
+		}
+	}
+
+	// With S3, the binary logs uploaded from another server do not count
+	if err := os.WriteFile(filepath.Join(r.root, "binlog.archived"),
+		[]byte("aaaaaaaa-0000-0000-0000-000000000000/mysql-bin.000004\nbbbbbbbb-0000-0000-0000-000000000000/mysql-bin.000003\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r.run(binlogArchiveScript, []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003", "mysql-bin.000004", "mysql-bin.000005"})
+	if got := r.archived("bbbbbbbb-0000-0000-0000-000000000000/mysql-bin.000003"); got != "" {
+		t.Errorf("binary log listed as uploaded was archived again: %q", got)
+	}
+	if got := r.archived("bbbbbbbb-0000-0000-0000-000000000000/mysql-bin.000004"); got == "" {
+		t.Error("binary log uploaded from another server was not archived")
+	}
+
+	// The point-in-time restore of the backup of the original data directory
+	// only replays its own binary logs
+	r.run(restoreScript, nil,
+		"BACKUP_FILE="+backupA, "TARGET_TIME=2024-06-15 12:00:00", "TARGET_STAMP=202406151200")
+	replayed, err := os.ReadFile(filepath.Join(r.root, "..", "replay.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "binlog/aaaaaaaa-0000-0000-0000-000000000000/mysql-bin.000002\n" +
+		"binlog/aaaaaaaa-0000-0000-0000-000000000000/mysql-bin.000003\n"
+	if string(replayed) != want {
+		t.Errorf("replayed binary logs:\n%s\nwant:\n%s", replayed, want)
+	}
+}
+
+func TestBinlogTimeline(t *testing.T) {
+	tests := []struct {
+		name        string
+		initialized bool
+		marked      string
+		claim       string
+		wantRotated bool
+		wantMarked  string
+	}{
+		{name: "new volume", claim: "recipe-mysql"},
+		{name: "volume of the recipe", initialized: true, claim: "recipe-mysql", wantMarked: "recipe-mysql"},
+		{name: "restarted volume", initialized: true, marked: "recipe-mysql", claim: "recipe-mysql", wantMarked: "recipe-mysql"},
+		{name: "restored volume", initialized: true, marked: "recipe-mysql", claim: "restore-mysql", wantRotated: true, wantMarked: "restore-mysql"},
+		{name: "restored volume never restarted", initialized: true, claim: "restore-mysql", wantRotated: true, wantMarked: "restore-mysql"},
+		{name: "restarted restored volume", initialized: true, marked: "restore-mysql", claim: "restore-mysql", wantMarked: "restore-mysql"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath("bash"); err != nil {
+				t.Skip("bash is not available")
+			}
+			dataDir := t.TempDir()
+			if tt.initialized {
+				if err := os.WriteFile(filepath.Join(dataDir, "auto.cnf"), []byte("[auto]\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.marked != "" {
+				if err := os.WriteFile(filepath.Join(dataDir, ".database-claim"), []byte(tt.marked+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cmd := exec.Command("bash", "-c", strings.ReplaceAll(binlogTimelineScript, "/var/lib/mysql", dataDir))
+			cmd.Env = append(os.Environ(), "DATABASE_CLAIM="+tt.claim, "DATABASE_CLAIM_ORIGIN=recipe-mysql")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("script failed: %v\n%s", err, out)
+			}
+
+			_, err := os.Stat(filepath.Join(dataDir, "auto.cnf"))
+			if rotated := tt.initialized && os.IsNotExist(err); rotated != tt.wantRotated {
+				t.Errorf("server UUID rotated = %v, want %v", rotated, tt.wantRotated)
+			}
+			marked, _ := os.ReadFile(filepath.Join(dataDir, ".database-claim"))
+			if got := strings.TrimSpace(string(marked)); got != tt.wantMarked {
+				t.Errorf("recorded volume = %q, want %q", got, tt.wantMarked)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// mysqlPingCommand checks MySQL answers on its TCP port, which it only opens
+// once the database is initialized
+var mysqlPingCommand = []string{"/bin/sh", "-c", `mysqladmin ping -h 127.0.0.1 -u root -p"${MYSQL_ROOT_PASSWORD}"`}
+
+// httpProbe calls path on the port of the recipe app
+func httpProbe(path string, periodSeconds int32, failureThreshold int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromInt32(5000),
+			},
+		},
+		TimeoutSeconds:   3,
+		PeriodSeconds:    periodSeconds,
+		FailureThreshold: failureThreshold,
+	}
+}
+
+// withAppProbes sets the probes of the recipe app container, the readiness
+// probe only passing once the app reaches the database
+func withAppProbes(recipe *devconfczv1alpha1.Recipe, container *corev1.Container) {
+	container.StartupProbe = httpProbe("/liveness", 5, 30)
+	container.LivenessProbe = httpProbe("/liveness", 10, 3)
+	container.ReadinessProbe = httpProbe("/readiness", 10, 3)
+
+	probes := recipe.Spec.Probes
+	if probes == nil {
+		return
+	}
+	if probes.Startup != nil {
+		container.StartupProbe = probes.Startup
+	}
+	if probes.Liveness != nil {
+		container.LivenessProbe = probes.Liveness
+	}
+	if probes.Readiness != nil {
+		container.ReadinessProbe = probes.Readiness
+	}
+}
+
+// withMySQLProbes sets the probes of the MySQL container. The startup probe
+// leaves up to 10 minutes for the first initialization of the database.
+func withMySQLProbes(container *corev1.Container) {
+	ping := corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{
+			Command: mysqlPingCommand,
+		},
+	}
+	container.StartupProbe = &corev1.Probe{
+		ProbeHandler:     ping,
+		TimeoutSeconds:   5,
+		PeriodSeconds:    10,
+		FailureThreshold: 60,
+	}
+	container.LivenessProbe = &corev1.Probe{
+		ProbeHandler:     ping,
+		TimeoutSeconds:   5,
+		PeriodSeconds:    10,
+		FailureThreshold: 3,
+	}
+	container.ReadinessProbe = &corev1.Probe{
+		ProbeHandler:     ping,
+		TimeoutSeconds:   5,
+		PeriodSeconds:    5,
+		FailureThreshold: 2,
+	}
+}
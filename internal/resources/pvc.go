@@ -28,6 +28,7 @@ func PersistentVolumeClaimForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *ru
 		},
 	}
 
+	withCommonMetadata(recipe, pvc)
 	// Set owner reference
 	if err := ctrl.SetControllerReference(recipe, pvc, scheme); err != nil {
 		return nil, err
@@ -56,6 +57,7 @@ func PersistentVolumeClaimForBackup(recipe *devconfczv1alpha1.Recipe, scheme *ru
 		},
 	}
 
+	withCommonMetadata(recipe, pvc)
 	// Set owner reference
 	if err := ctrl.SetControllerReference(recipe, pvc, scheme); err != nil {
 		return nil, err
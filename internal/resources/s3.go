@@ -0,0 +1,180 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// s3Image is the S3 client used to transfer backups to and from object storage
+var s3Image = "quay.io/minio/mc"
+
+// s3Setup registers the S3 destination as the "backup" alias of the mc client
+const s3Setup = "set -eo pipefail\n" + backupFormat + `MC="mc --quiet --config-dir /tmp/.mc"
+${MC} alias set backup "${S3_ENDPOINT}" "${AWS_ACCESS_KEY_ID}" "${AWS_SECRET_ACCESS_KEY}" > /dev/null
+S3_ROOT="backup/${S3_BUCKET}${S3_PREFIX:+/${S3_PREFIX}}"
+`
+
+// s3UploadScript uploads the dump written by the backup container, refreshes
+// the latest object and prunes the oldest dumps of the same generation.
+const s3UploadScript = s3Setup + `S3_DIR="${S3_ROOT}${BACKUP_GENERATION:+/${BACKUP_GENERATION}}"
+BACKUP_FILE="$(readlink "/backup/latest.${MYSQL_DATABASE}${BACKUP_EXT}")"
+${MC} mb --ignore-existing "backup/${S3_BUCKET}" > /dev/null
+echo "=> Upload ${BACKUP_FILE} to ${S3_DIR}"
+${MC} cp "/backup/${BACKUP_FILE}" "${S3_DIR}/"
+${MC} cp "/backup/${BACKUP_FILE}" "${S3_ROOT}/latest.${MYSQL_DATABASE}${BACKUP_EXT}"
+${MC} find "${S3_DIR}" --maxdepth 1 --name "[0-9]*.${MYSQL_DATABASE}.sql*" | sort -r | tail -n +$((MAX_BACKUPS + 1)) | while read -r OLD_BACKUP; do
+  echo "==> Max number of (${MAX_BACKUPS}) backups reached. Deleting ${OLD_BACKUP}"
+  ${MC} rm "${OLD_BACKUP}"
+done
+echo "${BACKUP_FILE}" > /dev/termination-log
+echo "=> Upload succeeded"
+`
+
+// s3DownloadScript downloads BACKUP_FILE, or the latest backup, so that the
+// restore container finds it at the same path as on the backup volume. When
+// a target time is requested, it picks the latest backup taken before it and
+// downloads the archived binary logs as well. With BACKUP_OPTIONAL, a missing
+// backup is left for the restore container to skip.
+const s3DownloadScript = s3Setup + backupBefore + `if [ -z "${BACKUP_FILE}" ] && [ -n "${TARGET_STAMP}" ]; then
+  BACKUP_FILE="$(${MC} find "${S3_ROOT}" --name "[0-9]*.${MYSQL_DATABASE}.sql*" | backup_before "${TARGET_STAMP}" "${S3_ROOT}/")"
+  if [ -z "${BACKUP_FILE}" ]; then
+    echo "No backup taken before ${TARGET_TIME}" | tee /dev/termination-log
+    exit 1
+  fi
+fi
+BACKUP_FILE="${BACKUP_FILE:-latest.${MYSQL_DATABASE}${BACKUP_EXT}}"
+mkdir -p "$(dirname "/backup/${BACKUP_FILE}")"
+if [ -n "${BACKUP_OPTIONAL}" ] && ! ${MC} stat "${S3_ROOT}/${BACKUP_FILE}" > /dev/null 2>&1; then
+  echo "=> No backup ${S3_ROOT}/${BACKUP_FILE} to download yet"
+  exit 0
+fi
+echo "=> Download ${S3_ROOT}/${BACKUP_FILE}"
+${MC} cp "${S3_ROOT}/${BACKUP_FILE}" "/backup/${BACKUP_FILE}"
+if [ -n "${TARGET_STAMP}" ]; then
+  echo "=> Download the binary logs"
+  ${MC} mirror "${S3_ROOT}/binlog" /backup/binlog
+fi
+`
+
+// s3BinlogListScript lists the binary logs already uploaded, as
+// <server UUID>/<name>, so that the binary log archive container only copies
+// the new ones.
+const s3BinlogListScript = s3Setup + `${MC} ls --recursive "${S3_ROOT}/binlog/" 2> /dev/null | sed 's/.* //' > /backup/binlog.archived || true
+`
+
+// s3BinlogUploadScript uploads the binary logs copied by the binary log archive container.
+const s3BinlogUploadScript = s3Setup + `${MC} mb --ignore-existing "backup/${S3_BUCKET}" > /dev/null
+echo "=> Upload the binary logs to ${S3_ROOT}/binlog"
+${MC} mirror /backup/binlog "${S3_ROOT}/binlog"
+`
+
+// backupVolumeForRecipe returns the volume mounted at /backup by the backup
+// and restore containers: the backup PVC, or a scratch volume when the
+// backups are stored in S3.
+func backupVolumeForRecipe(recipe *devconfczv1alpha1.Recipe) corev1.Volume {
+	volume := corev1.Volume{
+		Name: recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
+			},
+		},
+	}
+	if recipe.Spec.Database.BackupPolicy.Destination.S3 != nil {
+		volume.VolumeSource = corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		}
+	}
+	return volume
+}
+
+// s3ContainerForRecipe returns an S3 client container running script with
+// the environment of the given backup or restore container.
+func s3ContainerForRecipe(recipe *devconfczv1alpha1.Recipe, name string, script string, container corev1.Container) corev1.Container {
+	return s3Container(recipe.Spec.Database.BackupPolicy.Destination.S3, name, script, container)
+}
+
+// s3Container returns an S3 client container for the given S3 location
+// running script with the environment of the given container.
+func s3Container(s3 *devconfczv1alpha1.S3DestinationSpec, name string, script string, container corev1.Container) corev1.Container {
+	env := append([]corev1.EnvVar{}, container.Env...)
+	env = append(env, []corev1.EnvVar{
+		{
+			Name:  "S3_ENDPOINT",
+			Value: s3.Endpoint,
+		},
+		{
+			Name:  "S3_BUCKET",
+			Value: s3.Bucket,
+		},
+		{
+			Name:  "S3_PREFIX",
+			Value: s3.Prefix,
+		},
+		{
+			Name: "AWS_ACCESS_KEY_ID",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: s3.CredentialsSecretRef,
+					Key:                  "AWS_ACCESS_KEY_ID",
+				},
+			},
+		}, {
+			Name: "AWS_SECRET_ACCESS_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: s3.CredentialsSecretRef,
+					Key:                  "AWS_SECRET_ACCESS_KEY",
+				},
+			},
+		},
+	}...)
+
+	return corev1.Container{
+		Image:           s3Image,
+		Name:            name,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/bash", "-c", script},
+		Env:             env,
+		VolumeMounts:    container.VolumeMounts,
+		Resources:       container.Resources,
+	}
+}
+
+// withS3Upload makes the backup container of the pod an init container whose
+// dump is then uploaded to S3, when the recipe stores its backups there.
+func withS3Upload(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec) {
+	if recipe.Spec.Database.BackupPolicy.Destination.S3 == nil {
+		return
+	}
+	backup := podSpec.Containers[0]
+	podSpec.InitContainers = append(podSpec.InitContainers, backup)
+	podSpec.Containers = []corev1.Container{
+		s3ContainerForRecipe(recipe, "s3-upload", s3UploadScript, backup),
+	}
+}
+
+// withS3Download downloads the backup from S3 before the restore container
+// runs, when the recipe stores its backups there.
+func withS3Download(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec) {
+	if recipe.Spec.Database.BackupPolicy.Destination.S3 == nil {
+		return
+	}
+	podSpec.InitContainers = append(podSpec.InitContainers,
+		s3ContainerForRecipe(recipe, "s3-download", s3DownloadScript, podSpec.Containers[0]))
+}
+
+// withS3BinlogArchive uploads the binary logs copied by the binary log archive
+// container to S3, when the recipe stores its backups there.
+func withS3BinlogArchive(recipe *devconfczv1alpha1.Recipe, podSpec *corev1.PodSpec) {
+	if recipe.Spec.Database.BackupPolicy.Destination.S3 == nil {
+		return
+	}
+	archive := podSpec.Containers[0]
+	podSpec.InitContainers = append(podSpec.InitContainers,
+		s3ContainerForRecipe(recipe, "s3-binlog-list", s3BinlogListScript, archive),
+		archive)
+	podSpec.Containers = []corev1.Container{
+		s3ContainerForRecipe(recipe, "s3-binlog-upload", s3BinlogUploadScript, archive),
+	}
+}
@@ -0,0 +1,45 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// withScheduling sets the scheduling constraints of a workload on its pods
+func withScheduling(podSpec *corev1.PodSpec, scheduling *devconfczv1alpha1.SchedulingSpec) {
+	if scheduling == nil {
+		return
+	}
+	podSpec.NodeSelector = scheduling.NodeSelector
+	podSpec.Tolerations = scheduling.Tolerations
+	podSpec.Affinity = scheduling.Affinity
+	podSpec.TopologySpreadConstraints = scheduling.TopologySpreadConstraints
+	podSpec.PriorityClassName = scheduling.PriorityClassName
+	podSpec.RuntimeClassName = scheduling.RuntimeClassName
+}
+
+// appAffinityForRecipe prefers to schedule the replicas of the recipe app on
+// different nodes, unless the Recipe sets its own affinity
+func appAffinityForRecipe(recipe *devconfczv1alpha1.Recipe) *corev1.Affinity {
+	if recipe.Spec.Scheduling != nil && recipe.Spec.Scheduling.Affinity != nil {
+		return recipe.Spec.Scheduling.Affinity
+	}
+	return &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"app": recipe.Name,
+							},
+						},
+						TopologyKey: corev1.LabelHostname,
+					},
+				},
+			},
+		},
+	}
+}
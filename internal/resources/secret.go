@@ -21,6 +21,7 @@ func MySQLSecretForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sche
 		},
 	}
 
+	withCommonMetadata(recipe, secret)
 	if err := ctrl.SetControllerReference(recipe, secret, scheme); err != nil {
 		return nil, err
 	}
@@ -19,7 +19,10 @@ func MySQLServiceForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
 				{
-					Port: 3306,
+					Name:       "mysql",
+					Protocol:   corev1.ProtocolTCP,
+					Port:       3306,
+					TargetPort: intstr.FromInt(3306),
 				},
 			},
 			Selector: map[string]string{
@@ -28,6 +31,7 @@ func MySQLServiceForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 		},
 	}
 
+	withCommonMetadata(recipe, service)
 	// Set owner reference
 	if err := ctrl.SetControllerReference(recipe, service, scheme); err != nil {
 		return nil, err
@@ -36,7 +40,16 @@ func MySQLServiceForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sch
 	return service, nil
 }
 
-// RecipeServiceForRecipe creates a Service for the Recipe application and sets the owner reference
+// ServicePort returns the port the Service of the recipe app serves it on
+func ServicePort(recipe *devconfczv1alpha1.Recipe) int32 {
+	if recipe.Spec.Service != nil && recipe.Spec.Service.Port != 0 {
+		return recipe.Spec.Service.Port
+	}
+	return 80
+}
+
+// RecipeServiceForRecipe creates a Service for the Recipe application with
+// the type, port and annotations of spec.service and sets the owner reference
 func RecipeServiceForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*corev1.Service, error) {
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -44,19 +57,36 @@ func RecipeServiceForRecipe(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Sc
 			Namespace: recipe.Namespace,
 		},
 		Spec: corev1.ServiceSpec{
+			Type:            corev1.ServiceTypeClusterIP,
+			SessionAffinity: corev1.ServiceAffinityNone,
 			Selector: map[string]string{
 				"app": recipe.Name,
 			},
 			Ports: []corev1.ServicePort{
 				{
+					Name:       "http",
 					Protocol:   corev1.ProtocolTCP,
-					Port:       80,
+					Port:       ServicePort(recipe),
 					TargetPort: intstr.FromInt(5000),
 				},
 			},
 		},
 	}
+	if spec := recipe.Spec.Service; spec != nil {
+		withManagedAnnotations(service, spec.Annotations)
+		if spec.Type != "" {
+			service.Spec.Type = spec.Type
+		}
+		if spec.SessionAffinity != "" {
+			service.Spec.SessionAffinity = spec.SessionAffinity
+		}
+		// Source ranges are only allowed on LoadBalancer Services
+		if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			service.Spec.LoadBalancerSourceRanges = spec.LoadBalancerSourceRanges
+		}
+	}
 
+	withCommonMetadata(recipe, service)
 	// Set owner reference
 	if err := ctrl.SetControllerReference(recipe, service, scheme); err != nil {
 		return nil, err
@@ -0,0 +1,204 @@
+package resources
+
+import (
+	"strconv"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// SnapshotLockTimeout is the longest time the tables stay locked for a snapshot
+const SnapshotLockTimeout = 2 * time.Minute
+
+// snapshotLockScript locks the tables and flags the lock with /tmp/locked,
+// which makes the container ready. The lock is released when the pod is
+// deleted, or at the latest after LOCK_TIMEOUT seconds.
+const snapshotLockScript = `set -eo pipefail
+{
+  echo "FLUSH TABLES WITH READ LOCK;"
+  echo "system touch /tmp/locked"
+  sleep "${LOCK_TIMEOUT}"
+} | mysql -h "${MYSQL_HOST}" -u root -p"${MYSQL_ROOT_PASSWORD}" ${MYSQL_SSL_OPTS}
+`
+
+// DatabaseClaimName returns the name of the PVC holding the MySQL data
+func DatabaseClaimName(recipe *devconfczv1alpha1.Recipe) string {
+	if recipe.Status.DatabaseVolumeClaim != "" {
+		return recipe.Status.DatabaseVolumeClaim
+	}
+	return recipe.Name + "-mysql"
+}
+
+// SetDatabaseClaim makes the MySQL pod use the PVC as its data directory and
+// reports whether it changed. The other volumes, like the backup PVC, stay as
+// they are.
+func SetDatabaseClaim(podSpec *corev1.PodSpec, claim string) bool {
+	changed := false
+	for i, volume := range podSpec.Volumes {
+		if volume.Name == MySQLDataVolume && volume.PersistentVolumeClaim != nil &&
+			volume.PersistentVolumeClaim.ClaimName != claim {
+			podSpec.Volumes[i].PersistentVolumeClaim.ClaimName = claim
+			changed = true
+		}
+	}
+	for i, container := range podSpec.InitContainers {
+		if container.Name != binlogTimelineContainer {
+			continue
+		}
+		for j, env := range container.Env {
+			if env.Name == "DATABASE_CLAIM" && env.Value != claim {
+				podSpec.InitContainers[i].Env[j].Value = claim
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// JobForSnapshotLock creates a Job that holds a read lock on the MySQL Database while a snapshot is taken
+func JobForSnapshotLock(recipe *devconfczv1alpha1.Recipe, schedule devconfczv1alpha1.BackupScheduleSpec, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	image := databaseImage
+	if recipe.Spec.Database.Image != "" {
+		image = recipe.Spec.Database.Image
+	}
+
+	backoffLimit := int32(0)
+	activeDeadlineSeconds := int64(SnapshotLockTimeout.Seconds()) + 60
+	terminationGracePeriodSeconds := int64(1)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-snapshot-lock",
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app":               recipe.Name,
+				BackupScheduleLabel: schedule.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &activeDeadlineSeconds,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:           image,
+						Name:            "snapshot-lock",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources:       recipe.Spec.Database.JobResources,
+						Command:         []string{"/bin/bash", "-c", snapshotLockScript},
+						Env: []corev1.EnvVar{
+							{
+								Name:  "LOCK_TIMEOUT",
+								Value: strconv.Itoa(int(SnapshotLockTimeout.Seconds())),
+							},
+							{
+								Name: "MYSQL_HOST",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "DB_HOST",
+									},
+								},
+							}, {
+								Name: "MYSQL_ROOT_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql",
+										},
+										Key: "MYSQL_ROOT_PASSWORD",
+									},
+								},
+							},
+						},
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{
+								Exec: &corev1.ExecAction{
+									Command: []string{"test", "-f", "/tmp/locked"},
+								},
+							},
+							PeriodSeconds: 1,
+						},
+					}},
+					RestartPolicy:                 corev1.RestartPolicyNever,
+					TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
+				},
+			},
+		},
+	}
+
+	withJobDatabaseTLS(recipe, &job.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &job.Spec.Template)
+	withScheduling(&job.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withCommonMetadata(recipe, job, &job.Spec.Template)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// VolumeSnapshotForRecipe creates a VolumeSnapshot of the MySQL volume for a backup schedule
+func VolumeSnapshotForRecipe(recipe *devconfczv1alpha1.Recipe, schedule devconfczv1alpha1.BackupScheduleSpec, scheme *runtime.Scheme) (*snapshotv1.VolumeSnapshot, error) {
+	name := recipe.Name + "-snapshot-"
+	if schedule.Name != "" {
+		name += schedule.Name + "-"
+	}
+	name += time.Now().UTC().Format("20060102150405")
+
+	claimName := DatabaseClaimName(recipe)
+	snapshot := &snapshotv1.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app":               recipe.Name,
+				BackupScheduleLabel: schedule.Name,
+			},
+		},
+		Spec: snapshotv1.VolumeSnapshotSpec{
+			Source: snapshotv1.VolumeSnapshotSource{
+				PersistentVolumeClaimName: &claimName,
+			},
+		},
+	}
+	if recipe.Spec.Database.BackupPolicy.VolumeSnapshotClassName != "" {
+		snapshot.Spec.VolumeSnapshotClassName = &recipe.Spec.Database.BackupPolicy.VolumeSnapshotClassName
+	}
+
+	withCommonMetadata(recipe, snapshot)
+	if err := ctrl.SetControllerReference(recipe, snapshot, scheme); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// PersistentVolumeClaimFromSnapshot creates a PVC for MySQL restored from a VolumeSnapshot
+func PersistentVolumeClaimFromSnapshot(restore *devconfczv1alpha1.RecipeRestore, recipe *devconfczv1alpha1.Recipe, snapshot *snapshotv1.VolumeSnapshot, scheme *runtime.Scheme) (*corev1.PersistentVolumeClaim, error) {
+	pvc, err := PersistentVolumeClaimForRecipe(recipe, scheme)
+	if err != nil {
+		return nil, err
+	}
+	pvc.Name = recipe.Name + "-mysql-" + restore.Name
+	apiGroup := snapshotv1.GroupName
+	pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     "VolumeSnapshot",
+		Name:     snapshot.Name,
+	}
+	if snapshot.Status != nil && snapshot.Status.RestoreSize != nil &&
+		snapshot.Status.RestoreSize.Cmp(pvc.Spec.Resources.Requests[corev1.ResourceStorage]) > 0 {
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = *snapshot.Status.RestoreSize
+	}
+
+	return pvc, nil
+}
@@ -0,0 +1,209 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// PreUpgradeBackupGeneration is the backup generation holding the backups
+// taken before the MySQL image is changed, the CRD rejects schedules named after it
+const PreUpgradeBackupGeneration = "pre-upgrade"
+
+// upgradeScript waits for the upgraded MySQL, runs mysql_upgrade when the
+// image still ships it, MySQL 8.0.16 and later upgrading the system tables at
+// startup, and checks every table is compatible with the new server,
+// mysqlcheck reporting the incompatible ones with error or status lines.
+const upgradeScript = `set -eo pipefail
+MYSQL_AUTH=(-h "${MYSQL_HOST}" -u root -p"${MYSQL_ROOT_PASSWORD}" ${MYSQL_SSL_OPTS})
+for i in $(seq 60); do mysql "${MYSQL_AUTH[@]}" -e "SELECT 1" > /dev/null 2>&1 && break; sleep 5; done
+VERSION="$(mysql "${MYSQL_AUTH[@]}" -N -e "SELECT VERSION()")"
+echo "=> MySQL ${VERSION} is running"
+if command -v mysql_upgrade > /dev/null; then
+  mysql_upgrade "${MYSQL_AUTH[@]}"
+fi
+mysqlcheck "${MYSQL_AUTH[@]}" --all-databases --check-upgrade | tee /tmp/mysqlcheck.log
+# Only the message type and status columns count, not the table names
+if awk -F ' *: *' 'tolower($1) == "error" || (tolower($1) == "status" && $2 != "OK") { failed = 1 } END { exit !failed }' /tmp/mysqlcheck.log; then
+  echo "Table check failed after the upgrade to MySQL ${VERSION}" | tee /dev/termination-log
+  exit 1
+fi
+mysql "${MYSQL_AUTH[@]}" -e "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = '${MYSQL_DATABASE}'" > /dev/null
+echo "Upgraded to MySQL ${VERSION}" | tee /dev/termination-log
+`
+
+// wipeScript empties the MySQL data directory, so that the previous image
+// initializes a new database the pre-upgrade backup is restored into.
+const wipeScript = `set -eo pipefail
+echo "=> Remove the upgraded data files"
+find /var/lib/mysql -mindepth 1 -maxdepth 1 ! -name lost+found -exec rm -rf {} +
+`
+
+// JobForPreUpgradeBackup creates a Job that backs the database up before the MySQL image is changed
+func JobForPreUpgradeBackup(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	cronJob, err := CronJobForMySqlBackup(recipe, devconfczv1alpha1.BackupScheduleSpec{
+		Name:      PreUpgradeBackupGeneration,
+		Retention: 1,
+	}, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        recipe.Name + "-pre-upgrade-backup",
+			Namespace:   recipe.Namespace,
+			Labels:      cronJob.Spec.JobTemplate.Labels,
+			Annotations: cronJob.Spec.JobTemplate.Annotations,
+		},
+		Spec: cronJob.Spec.JobTemplate.Spec,
+	}
+
+	withCommonMetadata(recipe, job, &job.Spec.Template)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// JobForDatabaseUpgrade creates a Job that runs mysql_upgrade and checks the
+// tables once MySQL restarted with the image of the upgrade
+func JobForDatabaseUpgrade(recipe *devconfczv1alpha1.Recipe, image string, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-upgrade",
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			// A failed check rolls the upgrade back, it is retried only once
+			BackoffLimit: &[]int32{1}[0],
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:           image,
+						Name:            "mysql-upgrade",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources:       recipe.Spec.Database.JobResources,
+						Command:         []string{"/bin/bash", "-c", upgradeScript},
+						Env: []corev1.EnvVar{
+							{
+								Name: "MYSQL_HOST",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "DB_HOST",
+									},
+								},
+							}, {
+								Name: "MYSQL_DATABASE",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql-config",
+										},
+										Key: "MYSQL_DATABASE",
+									},
+								},
+							}, {
+								Name: "MYSQL_ROOT_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: recipe.Name + "-mysql",
+										},
+										Key: "MYSQL_ROOT_PASSWORD",
+									},
+								},
+							},
+						},
+					}},
+					RestartPolicy: "Never",
+				},
+			},
+		},
+	}
+
+	withJobDatabaseTLS(recipe, &job.Spec.Template.Spec)
+	withDatabaseClientLabel(recipe, &job.Spec.Template)
+	withScheduling(&job.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withCommonMetadata(recipe, job, &job.Spec.Template)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// JobForDatabaseWipe creates a Job that empties the MySQL volume while MySQL
+// is scaled down, with the image and security context of the MySQL pod
+func JobForDatabaseWipe(recipe *devconfczv1alpha1.Recipe, image string, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-upgrade-wipe",
+			Namespace: recipe.Namespace,
+			Labels: map[string]string{
+				"app": recipe.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					SecurityContext: recipe.Spec.Database.PodSecurityContext,
+					Containers: []corev1.Container{{
+						Image:           image,
+						Name:            "mysql-wipe",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources:       recipe.Spec.Database.JobResources,
+						Command:         []string{"/bin/bash", "-c", wipeScript},
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      MySQLDataVolume,
+								MountPath: "/var/lib/mysql",
+							},
+						},
+						SecurityContext: recipe.Spec.Database.SecurityContext,
+					}},
+					Volumes: []corev1.Volume{
+						{
+							Name: MySQLDataVolume,
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: DatabaseClaimName(recipe),
+								},
+							},
+						},
+					},
+					RestartPolicy: "OnFailure",
+				},
+			},
+		},
+	}
+
+	withScheduling(&job.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withCommonMetadata(recipe, job, &job.Spec.Template)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// JobForUpgradeRollback creates a Job that restores the pre-upgrade backup
+// once MySQL restarted with the previous image
+func JobForUpgradeRollback(recipe *devconfczv1alpha1.Recipe, backupName string, scheme *runtime.Scheme) (*batchv1.Job, error) {
+	job := restoreJobForRecipe(recipe, recipe.Name+"-upgrade-rollback", backupName, nil)
+	if err := ctrl.SetControllerReference(recipe, job, scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
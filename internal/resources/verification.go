@@ -0,0 +1,131 @@
+package resources
+
+import (
+	devconfczv1alpha1 "github.com/opdev/devconf-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// BackupVerificationLabel marks the backup verification CronJob and its Jobs
+const BackupVerificationLabel = "backup-verification"
+
+// verifyScript restores the latest backup into a throwaway MySQL server
+// started inside the container, checks the schema of the recipes table and
+// reports the number of recipes in the termination message.
+const verifyScript = "set -eo pipefail\n" + backupFormat + `BACKUP_FILE="/backup/${BACKUP_FILE:-latest.${MYSQL_DATABASE}${BACKUP_EXT}}"
+MYSQLD="$(command -v mysqld || echo /usr/libexec/mysqld)"
+MYSQLD_OPTS="--datadir=/var/lib/verify/data --socket=/var/lib/verify/mysql.sock --pid-file=/var/lib/verify/mysql.pid --skip-networking"
+[ "$(id -u)" = "0" ] && MYSQLD_OPTS="${MYSQLD_OPTS} --user=root"
+"${MYSQLD}" --no-defaults ${MYSQLD_OPTS} --initialize-insecure
+"${MYSQLD}" --no-defaults ${MYSQLD_OPTS} &
+MYSQL="mysql --no-defaults --socket=/var/lib/verify/mysql.sock -u root"
+for i in $(seq 60); do ${MYSQL} -e "SELECT 1" > /dev/null 2>&1 && break; sleep 1; done
+echo "=> Restore ${BACKUP_FILE} into a throwaway database"
+${MYSQL} -e "CREATE DATABASE ${MYSQL_DATABASE}"
+decode_backup "${BACKUP_FILE}" | ${MYSQL} "${MYSQL_DATABASE}"
+COLUMNS="$(${MYSQL} -N -e "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = '${MYSQL_DATABASE}' AND table_name = 'recipes' AND column_name IN ('id', 'title', 'ingredients', 'instructions', 'created_at', 'updated_at')")"
+if [ "${COLUMNS}" != "6" ]; then
+  echo "Schema check of the recipes table failed for $(basename "$(readlink -f "${BACKUP_FILE}")")" | tee /dev/termination-log
+  exit 1
+fi
+ROWS="$(${MYSQL} -N -e "SELECT COUNT(*) FROM recipes" "${MYSQL_DATABASE}")"
+echo "Verified $(basename "$(readlink -f "${BACKUP_FILE}")"): ${ROWS} recipes" | tee /dev/termination-log
+`
+
+// CronJobForBackupVerification creates a CronJob that verifies the latest backup of the MySQL Database
+func CronJobForBackupVerification(recipe *devconfczv1alpha1.Recipe, scheme *runtime.Scheme) (*batchv1.CronJob, error) {
+	image := databaseImage
+	if recipe.Spec.Database.Image != "" {
+		image = recipe.Spec.Database.Image
+	}
+
+	var timeZone *string
+	if recipe.Spec.Database.BackupPolicy.Tmz != "" {
+		timeZone = &recipe.Spec.Database.BackupPolicy.Tmz
+	}
+
+	labels := map[string]string{
+		"app":                   recipe.Name,
+		BackupVerificationLabel: "true",
+	}
+	backoffLimit := int32(0)
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recipe.Name + "-backup-verify",
+			Namespace: recipe.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			Schedule:          recipe.Spec.Database.BackupPolicy.Verification.Schedule,
+			TimeZone:          timeZone,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{
+								Image:                    image,
+								Name:                     "verify-backup",
+								ImagePullPolicy:          corev1.PullIfNotPresent,
+								Resources:                recipe.Spec.Database.JobResources,
+								Command:                  []string{"/bin/bash", "-c", verifyScript},
+								TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+								Env: append([]corev1.EnvVar{
+									{
+										Name: "MYSQL_DATABASE",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: recipe.Name + "-mysql-config",
+												},
+												Key: "MYSQL_DATABASE",
+											},
+										},
+									},
+								}, backupFormatEnvForRecipe(recipe)...),
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      recipe.Name + recipe.Spec.Database.BackupPolicy.VolumeName,
+										MountPath: "/backup",
+									},
+									{
+										Name:      "mysql-verify",
+										MountPath: "/var/lib/verify",
+									},
+								},
+							}},
+							Volumes: []corev1.Volume{
+								backupVolumeForRecipe(recipe),
+								{
+									Name: "mysql-verify",
+									VolumeSource: corev1.VolumeSource{
+										EmptyDir: &corev1.EmptyDirVolumeSource{},
+									},
+								},
+							},
+							RestartPolicy: corev1.RestartPolicyNever,
+						},
+					},
+				},
+			},
+		},
+	}
+	withScheduling(&cronJob.Spec.JobTemplate.Spec.Template.Spec, recipe.Spec.Database.JobScheduling)
+	withS3Download(recipe, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+
+	withCommonMetadata(recipe, cronJob, &cronJob.Spec.JobTemplate.Spec.Template)
+	PropagateMetadata(recipe, &cronJob.Spec.JobTemplate)
+	if err := ctrl.SetControllerReference(recipe, cronJob, scheme); err != nil {
+		return nil, err
+	}
+
+	return cronJob, nil
+}
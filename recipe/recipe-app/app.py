@@ -1,5 +1,5 @@
 from flask import Flask, request, jsonify, render_template, redirect, url_for
-from models import create_connection
+from models import create_connection, ssl_options
 from datetime import datetime
 import pymysql
 import os
@@ -88,6 +88,7 @@ def check_database_connection():
             password=os.environ.get('DB_PASSWORD', ''),
             database=os.environ.get('DB_NAME', 'recipes'),
             port=int(os.environ.get('DB_PORT', 3306)),
+            ssl=ssl_options(),
             connect_timeout=5
         )
         connection.close()
@@ -2,12 +2,26 @@ import pymysql
 import os
 from datetime import datetime
 
+def ssl_options():
+    # DB_SSL_CA and DB_SSL_MODE are set by the operator when the connections
+    # to the database are encrypted, the modes follow those of the mysql client
+    ca = os.getenv('DB_SSL_CA')
+    mode = os.getenv('DB_SSL_MODE', 'VERIFY_IDENTITY' if ca else 'DISABLED').upper()
+    if mode == 'DISABLED' or mode == 'PREFERRED':
+        return None
+    options = {'ca': ca} if ca else {}
+    options['check_hostname'] = mode == 'VERIFY_IDENTITY'
+    if mode == 'REQUIRED':
+        options['verify_mode'] = False
+    return options
+
 def create_connection():
     connection = pymysql.connect(
         host=os.getenv('DB_HOST'),
         user=os.getenv('DB_USER'),
         password=os.getenv('DB_PASSWORD'),
         database=os.getenv('DB_NAME'),
+        ssl=ssl_options(),
         cursorclass=pymysql.cursors.DictCursor
     )
     return connection